@@ -0,0 +1,143 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var errNotStarted = errors.New("capture: client not started")
+
+// Option configures a client returned by NewClient.
+type Option func(*config)
+
+type config struct {
+	format   Format
+	maxBytes int64
+}
+
+// WithFormat sets the file format. The default is JSONLines.
+func WithFormat(f Format) Option {
+	return func(cfg *config) {
+		cfg.format = f
+	}
+}
+
+// WithMaxBytes rotates the file before a write would take it past n
+// bytes. The full file is renamed to the first free name of the form
+// filename.1, filename.2 and so on. Zero disables rotation.
+func WithMaxBytes(n int64) Option {
+	return func(cfg *config) {
+		cfg.maxBytes = n
+	}
+}
+
+type client struct {
+	filename string
+	cfg      config
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	next int
+}
+
+// NewClient returns an otlpmetric.Client that appends every upload to
+// filename as one ExportMetricsServiceRequest.
+func NewClient(filename string, opts ...Option) otlpmetric.Client {
+	c := &client{filename: filename, next: 1}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start opens the file for appending, creating it if needed.
+func (c *client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.open()
+}
+
+func (c *client) open() error {
+	f, err := os.OpenFile(c.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.file, c.size = f, fi.Size()
+	return nil
+}
+
+// Stop flushes the file to stable storage and closes it.
+func (c *client) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Sync()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file = nil
+	return err
+}
+
+// UploadMetrics appends protoMetrics to the file.
+func (c *client) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	b, err := Encode(c.cfg.format, &colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: protoMetrics})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return errNotStarted
+	}
+	if c.cfg.maxBytes > 0 && c.size > 0 && c.size+int64(len(b)) > c.cfg.maxBytes {
+		if err := c.rotate(); err != nil {
+			return fmt.Errorf("capture: rotating %s: %w", c.filename, err)
+		}
+	}
+	n, err := c.file.Write(b)
+	c.size += int64(n)
+	return err
+}
+
+// rotate moves the current file aside and starts a new one.
+func (c *client) rotate() error {
+	if err := c.file.Sync(); err != nil {
+		return err
+	}
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	c.file = nil
+
+	for {
+		name := fmt.Sprintf("%s.%d", c.filename, c.next)
+		c.next++
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			if err := os.Rename(c.filename, name); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return c.open()
+}
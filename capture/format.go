@@ -0,0 +1,189 @@
+// Package capture stores OTLP metric export requests in files and reads
+// them back.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Format is the on-disk encoding of a capture.
+type Format int
+
+const (
+	// JSONLines stores one protojson ExportMetricsServiceRequest per line.
+	JSONLines Format = iota
+	// Delimited stores binary ExportMetricsServiceRequest messages, each
+	// preceded by its length as a varint.
+	Delimited
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSONLines:
+		return "jsonl"
+	case Delimited:
+		return "delimited"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat parses the String form of a Format.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "jsonl":
+		return JSONLines, nil
+	case "delimited":
+		return Delimited, nil
+	}
+	return 0, fmt.Errorf("unknown capture format %q", s)
+}
+
+// maxMessageSize bounds the length prefix accepted by Reader so that a
+// corrupt file does not cause a huge allocation.
+const maxMessageSize = 64 << 20
+
+var errMessageTooLarge = errors.New("capture: message exceeds maximum size")
+
+// Encode returns the encoding of req in format f, including the line
+// terminator or length prefix.
+func Encode(f Format, req *colmetricpb.ExportMetricsServiceRequest) ([]byte, error) {
+	switch f {
+	case JSONLines:
+		b, err := protojson.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case Delimited:
+		b, err := proto.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		return append(protowire.AppendVarint(nil, uint64(len(b))), b...), nil
+	}
+	return nil, fmt.Errorf("unknown capture format %v", f)
+}
+
+// Reader decodes requests written in one Format.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+}
+
+// NewReader returns a Reader of r.
+func NewReader(r io.Reader, format Format) *Reader {
+	return &Reader{r: bufio.NewReader(r), format: format}
+}
+
+// Next returns the next request, or io.EOF when there are no more.
+// Blank lines in JSONLines captures are skipped.
+func (r *Reader) Next() (*colmetricpb.ExportMetricsServiceRequest, error) {
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	switch r.format {
+	case JSONLines:
+		for {
+			line, err := r.r.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				if err := protojson.Unmarshal(line, req); err != nil {
+					return nil, err
+				}
+				return req, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	case Delimited:
+		size, err := readVarint(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxMessageSize {
+			return nil, errMessageTooLarge
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return nil, noEOF(err)
+		}
+		if err := proto.Unmarshal(buf, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	return nil, fmt.Errorf("unknown capture format %v", r.format)
+}
+
+// readVarint reads a varint length prefix. A clean end of input before
+// the first byte is reported as io.EOF.
+func readVarint(r io.ByteReader) (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			if shift > 0 {
+				return 0, noEOF(err)
+			}
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("capture: malformed length prefix")
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadFile returns every request stored in filename, in either format.
+// The first byte does not tell them apart: a Delimited capture whose first
+// request is 123 or 10 bytes long starts with '{' or '\n'. So a capture
+// that starts like JSONLines is read as Delimited if it does not decode as
+// JSONLines.
+func ReadFile(filename string) ([]*colmetricpb.ExportMetricsServiceRequest, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 && (b[0] == '{' || b[0] == '\n') {
+		reqs, err := readAll(filename, b, JSONLines)
+		if err == nil {
+			return reqs, nil
+		}
+		if delimited, derr := readAll(filename, b, Delimited); derr == nil {
+			return delimited, nil
+		}
+		return reqs, err
+	}
+	return readAll(filename, b, Delimited)
+}
+
+func readAll(filename string, b []byte, format Format) ([]*colmetricpb.ExportMetricsServiceRequest, error) {
+	r := NewReader(bytes.NewReader(b), format)
+	var reqs []*colmetricpb.ExportMetricsServiceRequest
+	for {
+		req, err := r.Next()
+		if err == io.EOF {
+			return reqs, nil
+		}
+		if err != nil {
+			return reqs, fmt.Errorf("%s: request %d: %w", filename, len(reqs), err)
+		}
+		reqs = append(reqs, req)
+	}
+}
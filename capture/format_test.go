@@ -0,0 +1,99 @@
+package capture
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// request returns a request for one metric whose encoding takes size
+// bytes.
+func request(t *testing.T, size int) *colmetricpb.ExportMetricsServiceRequest {
+	t.Helper()
+	for n := 1; n < size; n++ {
+		req := &colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricpb.ResourceMetrics{{
+			InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+				Metrics: []*metricpb.Metric{{Name: strings.Repeat("m", n)}},
+			}},
+		}}}
+		if proto.Size(req) == size {
+			return req
+		}
+	}
+	t.Fatalf("no request takes %d bytes", size)
+	return nil
+}
+
+func writeCapture(t *testing.T, format Format, reqs ...*colmetricpb.ExportMetricsServiceRequest) string {
+	t.Helper()
+	var b []byte
+	for _, req := range reqs {
+		enc, err := Encode(format, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, enc...)
+	}
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "capture")
+	if err := ioutil.WriteFile(filename, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadFile(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		format Format
+		// size is the encoded size of the first request.
+		size int
+	}{
+		{name: "jsonl", format: JSONLines, size: 40},
+		{name: "delimited", format: Delimited, size: 40},
+		// The length prefix of the first request reads as '{'.
+		{name: "delimited starting with a brace", format: Delimited, size: '{'},
+		// The length prefix of the first request reads as '\n'.
+		{name: "delimited starting with a newline", format: Delimited, size: '\n'},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := []*colmetricpb.ExportMetricsServiceRequest{request(t, tc.size), request(t, 50)}
+			got, err := ReadFile(writeCapture(t, tc.format, want...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d requests, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !proto.Equal(got[i], want[i]) {
+					t.Errorf("request %d: got %v, want %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadFileCorrupt(t *testing.T) {
+	filename := writeCapture(t, JSONLines, request(t, 40))
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, append(b, "{not json\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(filename); err == nil || !strings.Contains(err.Error(), "request 1") {
+		t.Errorf("got %v, want the JSON error of request 1", err)
+	}
+}
@@ -0,0 +1,45 @@
+package capture
+
+import (
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+)
+
+// Latest returns the largest TimeUnixNano of any point in reqs.
+func Latest(reqs []*colmetricpb.ExportMetricsServiceRequest) uint64 {
+	var latest uint64
+	forEachTimestamp(reqs, func(start, end *uint64) {
+		if *end > latest {
+			latest = *end
+		}
+	})
+	return latest
+}
+
+// Shift adds delta nanoseconds to every non-zero start and end time in
+// reqs, modifying them in place.
+func Shift(reqs []*colmetricpb.ExportMetricsServiceRequest, delta int64) {
+	shift := func(t *uint64) {
+		if *t != 0 {
+			*t = uint64(int64(*t) + delta)
+		}
+	}
+	forEachTimestamp(reqs, func(start, end *uint64) {
+		shift(start)
+		shift(end)
+	})
+}
+
+func forEachTimestamp(reqs []*colmetricpb.ExportMetricsServiceRequest, fn func(start, end *uint64)) {
+	for _, req := range reqs {
+		for _, rm := range req.GetResourceMetrics() {
+			for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+				for _, m := range ilm.GetMetrics() {
+					for _, p := range otlpclient.Points(m) {
+						fn(otlpclient.Timestamps(p))
+					}
+				}
+			}
+		}
+	}
+}
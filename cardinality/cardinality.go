@@ -0,0 +1,246 @@
+// Package cardinality inspects a checkpoint set before it is exported and
+// reports, per instrument, how many label sets and points it holds and
+// which of them Cloud Monitoring would treat as the same time series.
+package cardinality
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"go.opentelemetry.io/otel/attribute"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Option configures Analyze and NewExporter.
+type Option func(*config)
+
+type config struct {
+	gcm     gcm.Config
+	dropped map[string]bool
+}
+
+// WithConfig sets the Cloud Monitoring mapping that decides which label
+// sets are written to the same time series, as gcm.Validator does. The
+// default, the zero gcm.Config, ignores point attributes like the
+// googlecloud exporter, so every label set of an instrument collides.
+func WithConfig(c gcm.Config) Option {
+	return func(cfg *config) {
+		cfg.gcm = c
+	}
+}
+
+// WithDroppedKeys names label keys the backend discards, for example
+// because of a label limit or a relabelling rule. Label sets that differ
+// only in these keys are reported as collisions.
+func WithDroppedKeys(keys ...string) Option {
+	return func(cfg *config) {
+		if cfg.dropped == nil {
+			cfg.dropped = make(map[string]bool)
+		}
+		for _, k := range keys {
+			cfg.dropped[k] = true
+		}
+	}
+}
+
+// Series is one label set of an instrument.
+type Series struct {
+	// Labels is the label set as recorded, e.g. "rpc.method=Hi".
+	Labels string
+	// Points is the number of OTLP points the record becomes. Only
+	// aggregations that keep raw points produce more than one.
+	Points int
+}
+
+// Collision is a group of label sets that map to the same time series.
+type Collision struct {
+	// Key is the metric labels of the time series, e.g. "rpc_method=Hi".
+	Key    string
+	Labels []string
+}
+
+// Instrument summarises the records of one instrument.
+type Instrument struct {
+	Name        string
+	Aggregation aggregation.Kind
+	Series      []Series
+	Collisions  []Collision
+}
+
+// MaxPoints returns the largest number of points of any label set.
+func (in Instrument) MaxPoints() int {
+	max := 0
+	for _, s := range in.Series {
+		if s.Points > max {
+			max = s.Points
+		}
+	}
+	return max
+}
+
+// Report is the analysis of one checkpoint set.
+type Report struct {
+	Instruments []Instrument
+}
+
+// Warnings lists every series that would be written more than once in a
+// single request, either because its record holds several points or
+// because several label sets collide.
+func (r Report) Warnings() []string {
+	var out []string
+	for _, in := range r.Instruments {
+		for _, s := range in.Series {
+			if s.Points > 1 {
+				out = append(out, fmt.Sprintf("%s{%s}: %d points in one request", in.Name, s.Labels, s.Points))
+			}
+		}
+		for _, c := range in.Collisions {
+			out = append(out, fmt.Sprintf("%s{%s}: written by %d label sets: %s", in.Name, c.Key, len(c.Labels), strings.Join(c.Labels, "; ")))
+		}
+	}
+	return out
+}
+
+// Analyze walks the checkpoint set with the given export kind selector.
+// The caller must hold the checkpoint set's read lock.
+func Analyze(cs export.CheckpointSet, kinds export.ExportKindSelector, opts ...Option) (Report, error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	seriesKey := gcm.SeriesKey(cfg.gcm)
+	byName := map[string]*Instrument{}
+	// groups collects the label sets of each instrument by time series.
+	groups := map[string]map[string]*Collision{}
+	err := cs.ForEach(kinds, func(rec export.Record) error {
+		name := rec.Descriptor().Name()
+		in, ok := byName[name]
+		if !ok {
+			in = &Instrument{Name: name, Aggregation: rec.Aggregation().Kind()}
+			byName[name] = in
+			groups[name] = map[string]*Collision{}
+		}
+		points, err := pointCount(rec.Aggregation())
+		if err != nil {
+			return err
+		}
+		labels := labelsString(rec.Labels())
+		in.Series = append(in.Series, Series{Labels: labels, Points: points})
+
+		payload := pointPayload(rec, cfg.dropped)
+		key := seriesKey(payload)
+		g, ok := groups[name][key]
+		if !ok {
+			g = &Collision{Key: metricLabels(cfg.gcm, payload)}
+			groups[name][key] = g
+		}
+		g.Labels = append(g.Labels, labels)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	var r Report
+	for name, in := range byName {
+		sort.Slice(in.Series, func(i, j int) bool { return in.Series[i].Labels < in.Series[j].Labels })
+		for _, g := range groups[name] {
+			if len(g.Labels) > 1 {
+				sort.Strings(g.Labels)
+				in.Collisions = append(in.Collisions, *g)
+			}
+		}
+		sort.Slice(in.Collisions, func(i, j int) bool { return in.Collisions[i].Key < in.Collisions[j].Key })
+		r.Instruments = append(r.Instruments, *in)
+	}
+	sort.Slice(r.Instruments, func(i, j int) bool { return r.Instruments[i].Name < r.Instruments[j].Name })
+	return r, nil
+}
+
+// pointCount returns how many OTLP points an aggregation is exported as.
+func pointCount(agg aggregation.Aggregation) (int, error) {
+	if p, ok := agg.(aggregation.Points); ok {
+		pts, err := p.Points()
+		if err != nil {
+			return 0, err
+		}
+		return len(pts), nil
+	}
+	return 1, nil
+}
+
+// labelsString renders a label set sorted by key.
+func labelsString(set *attribute.Set) string {
+	var parts []string
+	for iter := set.Iter(); iter.Next(); {
+		kv := iter.Label()
+		parts = append(parts, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// pointPayload returns a payload holding one point of rec as the OTLP
+// exporter sends it, with its labels as attributes less the dropped keys,
+// for gcm to map onto a time series. The values of the point do not
+// matter.
+func pointPayload(rec export.Record, dropped map[string]bool) []*metricpb.ResourceMetrics {
+	return []*metricpb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: keyValues(rec.Resource().Set(), nil)},
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricpb.Metric{{
+				Name: rec.Descriptor().Name(),
+				Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+					DataPoints: []*metricpb.NumberDataPoint{{
+						Attributes:   keyValues(rec.Labels(), dropped),
+						TimeUnixNano: uint64(rec.EndTime().UnixNano()),
+					}},
+				}},
+			}},
+		}},
+	}}
+}
+
+func keyValues(set *attribute.Set, dropped map[string]bool) []*commonpb.KeyValue {
+	var out []*commonpb.KeyValue
+	for iter := set.Iter(); iter.Next(); {
+		kv := iter.Label()
+		if dropped[string(kv.Key)] {
+			continue
+		}
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: anyValue(kv.Value)})
+	}
+	return out
+}
+
+func anyValue(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+}
+
+// metricLabels renders the metric labels of the time series of payload,
+// sorted by key.
+func metricLabels(cfg gcm.Config, payload []*metricpb.ResourceMetrics) string {
+	var parts []string
+	for _, s := range gcm.SeriesFor(cfg, payload) {
+		for k, v := range s.MetricLabels {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,117 @@
+package cardinality
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+)
+
+// analyze records each label set once, or values times, with the exact
+// selector and analyzes the collection.
+func analyze(t *testing.T, labelSets [][]attribute.KeyValue, values int, opts ...Option) Report {
+	t.Helper()
+	ctx := context.Background()
+	kinds := export.CumulativeExportKindSelector()
+	proc := processor.New(selector.NewWithExactDistribution(), kinds)
+	cont := controller.New(proc)
+	recorder := metric.Must(cont.MeterProvider().Meter("test")).NewInt64ValueRecorder("test.dummy.one")
+	for _, labels := range labelSets {
+		for i := 0; i < values; i++ {
+			recorder.Record(ctx, int64(i), labels...)
+		}
+	}
+	if err := cont.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := proc.CheckpointSet()
+	cs.RLock()
+	defer cs.RUnlock()
+	r, err := Analyze(cs, kinds, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCollisions(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		labelSets [][]attribute.KeyValue
+		opts      []Option
+		want      []Collision
+	}{
+		{
+			// What Cases #1 to #3 of main.go run into.
+			name: "attributes ignored",
+			labelSets: [][]attribute.KeyValue{
+				{attribute.String("rpc.method", "Hello")},
+				{attribute.String("rpc.method", "Hi")},
+			},
+			want: []Collision{{Key: "", Labels: []string{"rpc.method=Hello", "rpc.method=Hi"}}},
+		},
+		{
+			name: "attributes mapped",
+			labelSets: [][]attribute.KeyValue{
+				{attribute.String("rpc.method", "Hello")},
+				{attribute.String("rpc.method", "Hi")},
+			},
+			opts: []Option{WithConfig(gcm.Config{PointAttributes: true})},
+		},
+		{
+			name: "sanitized keys",
+			labelSets: [][]attribute.KeyValue{
+				{attribute.Int("rpc.code", 1)},
+				{attribute.Int("rpc_code", 1)},
+			},
+			opts: []Option{WithConfig(gcm.Config{PointAttributes: true})},
+			want: []Collision{{Key: "rpc_code=1", Labels: []string{"rpc.code=1", "rpc_code=1"}}},
+		},
+		{
+			name: "dropped keys",
+			labelSets: [][]attribute.KeyValue{
+				{attribute.String("rpc.method", "Hello"), attribute.String("peer", "a")},
+				{attribute.String("rpc.method", "Hello"), attribute.String("peer", "b")},
+				{attribute.String("rpc.method", "Hi"), attribute.String("peer", "a")},
+			},
+			opts: []Option{WithConfig(gcm.Config{PointAttributes: true}), WithDroppedKeys("peer")},
+			want: []Collision{{Key: "rpc_method=Hello", Labels: []string{"peer=a,rpc.method=Hello", "peer=b,rpc.method=Hello"}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := analyze(t, tc.labelSets, 1, tc.opts...)
+			if len(r.Instruments) != 1 {
+				t.Fatalf("got %d instruments, want 1", len(r.Instruments))
+			}
+			in := r.Instruments[0]
+			if len(in.Series) != len(tc.labelSets) {
+				t.Errorf("got %d label sets, want %d", len(in.Series), len(tc.labelSets))
+			}
+			if !reflect.DeepEqual(in.Collisions, tc.want) {
+				t.Errorf("got collisions %v, want %v", in.Collisions, tc.want)
+			}
+		})
+	}
+}
+
+func TestPoints(t *testing.T) {
+	r := analyze(t, [][]attribute.KeyValue{{attribute.String("rpc.method", "Hello")}}, 3,
+		WithConfig(gcm.Config{PointAttributes: true}))
+	in := r.Instruments[0]
+	if got := in.MaxPoints(); got != 3 {
+		t.Errorf("got %d points, want 3", got)
+	}
+	warnings := r.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "test.dummy.one{rpc.method=Hello}: 3 points in one request") {
+		t.Errorf("got warnings %q", warnings)
+	}
+}
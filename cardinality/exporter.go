@@ -0,0 +1,29 @@
+package cardinality
+
+import (
+	"context"
+
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+)
+
+type exporter struct {
+	export.Exporter
+
+	opts    []Option
+	handler func(Report)
+}
+
+// NewExporter wraps exp so that every checkpoint set is analysed and the
+// report passed to handler before exp exports it. A failed analysis does
+// not stop the export.
+func NewExporter(exp export.Exporter, handler func(Report), opts ...Option) export.Exporter {
+	return &exporter{Exporter: exp, opts: opts, handler: handler}
+}
+
+// Export analyses checkpointSet, then exports it.
+func (e *exporter) Export(ctx context.Context, checkpointSet export.CheckpointSet) error {
+	if r, err := Analyze(checkpointSet, e.Exporter, e.opts...); err == nil {
+		e.handler(r)
+	}
+	return e.Exporter.Export(ctx, checkpointSet)
+}
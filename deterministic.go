@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/manualclock"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// deterministicStart is the manual clock reading before the first
+// collection. It is the start time of Case #2 in main.go.
+var deterministicStart = time.Date(2021, 8, 26, 3, 20, 55, 0, time.UTC)
+
+// deterministicResource replaces the default resource, whose service.name
+// is derived from the executable name.
+func deterministicResource() *resource.Resource {
+	res, _ := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String("export-otlp-googlecloud"),
+	))
+	return res
+}
+
+// runSteps does what the controller's ticker would do, one collect period
+// at a time: advance the clock, collect, and export the checkpoint set.
+func runSteps(ctx context.Context, cont *controller.Controller, proc *processor.Processor, exporter export.Exporter, clock *manualclock.Clock, period time.Duration, steps int) error {
+	for i := 0; i < steps; i++ {
+		clock.Advance(period)
+		if err := cont.Collect(ctx); err != nil {
+			return err
+		}
+		clock.Mark()
+
+		if err := exportCheckpoint(ctx, proc, exporter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCheckpoint(ctx context.Context, proc *processor.Processor, exporter export.Exporter) error {
+	ckpt := proc.CheckpointSet()
+	ckpt.RLock()
+	defer ckpt.RUnlock()
+
+	return exporter.Export(ctx, ckpt)
+}
+
+// marshalJSON renders m as indented JSON. protojson deliberately varies
+// its whitespace between builds, so the output is re-indented to keep it
+// stable.
+func marshalJSON(m proto.Message) ([]byte, error) {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,322 @@
+// Package diff compares two sets of OTLP metrics series by series.
+//
+// Series are aligned by resource, instrumentation library, metric name and
+// point attributes. Points within a series are compared in the order they
+// appear, so several uploads of the same series line up as long as both
+// sides made the same number of them.
+package diff
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Kind classifies a Change.
+type Kind int
+
+const (
+	// Added is a series only present in the second set.
+	Added Kind = iota
+	// Removed is a series only present in the first set.
+	Removed
+	// DataType is a change of metric data type, e.g. Gauge to Histogram.
+	DataType
+	// Temporality is a change of aggregation temporality or monotonicity.
+	Temporality
+	// PointCount is a change in the number of points of a series.
+	PointCount
+	// Value is a change in a point's value, count, sum, buckets or
+	// quantiles.
+	Value
+	// Timestamp is a change in a point's start or end time. It is only
+	// reported when Options.Timestamps is set.
+	Timestamp
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case DataType:
+		return "data type"
+	case Temporality:
+		return "temporality"
+	case PointCount:
+		return "point count"
+	case Value:
+		return "value"
+	case Timestamp:
+		return "timestamp"
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Key identifies a series.
+type Key struct {
+	Resource   string
+	Library    string
+	Metric     string
+	Attributes string
+}
+
+// String returns the series without its resource, which is usually shared
+// by every series in a capture.
+func (k Key) String() string {
+	s := k.Metric + "{" + k.Attributes + "}"
+	if k.Library != "" {
+		s = k.Library + "/" + s
+	}
+	return s
+}
+
+// Change is a single difference between the two sets.
+type Change struct {
+	Kind   Kind
+	Key    Key
+	Detail string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s: %s", c.Key, c.Kind, c.Detail)
+}
+
+// Options tunes Compare.
+type Options struct {
+	// Timestamps also compares point start and end times.
+	Timestamps bool
+}
+
+// Compare returns the changes that turn a into b, ordered by series key.
+func Compare(a, b []*metricpb.ResourceMetrics, opts Options) []Change {
+	before, after := index(a), index(b)
+
+	keys := make([]Key, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ki, kj := keys[i], keys[j]
+		if ki.Resource != kj.Resource {
+			return ki.Resource < kj.Resource
+		}
+		if ki.Library != kj.Library {
+			return ki.Library < kj.Library
+		}
+		if ki.Metric != kj.Metric {
+			return ki.Metric < kj.Metric
+		}
+		return ki.Attributes < kj.Attributes
+	})
+
+	var changes []Change
+	for _, k := range keys {
+		sa, inA := before[k]
+		sb, inB := after[k]
+		switch {
+		case !inA:
+			changes = append(changes, Change{Added, k, sb.describe()})
+		case !inB:
+			changes = append(changes, Change{Removed, k, sa.describe()})
+		default:
+			changes = append(changes, compareSeries(k, sa, sb, opts)...)
+		}
+	}
+	return changes
+}
+
+// series is every point of one series, in order of appearance.
+type series struct {
+	dataType    string
+	temporality string
+	points      []point
+}
+
+func (s *series) describe() string {
+	desc := s.dataType
+	if s.temporality != "" {
+		desc += ", " + s.temporality
+	}
+	return fmt.Sprintf("%s, %d points", desc, len(s.points))
+}
+
+// point holds the comparable fields of any point type.
+type point struct {
+	start, end uint64
+	fields     []field
+}
+
+type field struct {
+	name  string
+	value float64
+}
+
+func compareSeries(k Key, a, b *series, opts Options) []Change {
+	if a.dataType != b.dataType {
+		return []Change{{DataType, k, a.dataType + " -> " + b.dataType}}
+	}
+
+	var changes []Change
+	if a.temporality != b.temporality {
+		changes = append(changes, Change{Temporality, k, a.temporality + " -> " + b.temporality})
+	}
+	if len(a.points) != len(b.points) {
+		changes = append(changes, Change{PointCount, k, fmt.Sprintf("%d -> %d", len(a.points), len(b.points))})
+	}
+	n := len(a.points)
+	if len(b.points) < n {
+		n = len(b.points)
+	}
+	for i := 0; i < n; i++ {
+		pa, pb := a.points[i], b.points[i]
+		if opts.Timestamps {
+			if pa.start != pb.start {
+				changes = append(changes, Change{Timestamp, k, fmt.Sprintf("point #%d start %d -> %d", i, pa.start, pb.start)})
+			}
+			if pa.end != pb.end {
+				changes = append(changes, Change{Timestamp, k, fmt.Sprintf("point #%d time %d -> %d", i, pa.end, pb.end)})
+			}
+		}
+		for _, d := range compareFields(pa.fields, pb.fields) {
+			changes = append(changes, Change{Value, k, fmt.Sprintf("point #%d %s", i, d)})
+		}
+	}
+	return changes
+}
+
+// compareFields describes each field whose value differs, in the order of
+// a followed by fields only present in b.
+func compareFields(a, b []field) []string {
+	bv := make(map[string]float64, len(b))
+	for _, f := range b {
+		bv[f.name] = f.value
+	}
+	seen := make(map[string]bool, len(a))
+	var out []string
+	for _, f := range a {
+		seen[f.name] = true
+		v, ok := bv[f.name]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("%s %s -> none", f.name, number(f.value)))
+		case v != f.value && !(math.IsNaN(v) && math.IsNaN(f.value)):
+			out = append(out, fmt.Sprintf("%s %s -> %s (%+g)", f.name, number(f.value), number(v), v-f.value))
+		}
+	}
+	for _, f := range b {
+		if !seen[f.name] {
+			out = append(out, fmt.Sprintf("%s none -> %s", f.name, number(f.value)))
+		}
+	}
+	return out
+}
+
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func index(rms []*metricpb.ResourceMetrics) map[Key]*series {
+	out := map[Key]*series{}
+	for _, rm := range rms {
+		res := otlptext.Attributes(rm.GetResource().GetAttributes())
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			lib := ilm.GetInstrumentationLibrary().GetName()
+			if v := ilm.GetInstrumentationLibrary().GetVersion(); v != "" {
+				lib += "@" + v
+			}
+			for _, m := range ilm.GetMetrics() {
+				dataType, temporality := describe(m)
+				add := func(attrs []*commonpb.KeyValue, p point) {
+					k := Key{Resource: res, Library: lib, Metric: m.GetName(), Attributes: otlptext.Attributes(attrs)}
+					s, ok := out[k]
+					if !ok {
+						s = &series{dataType: dataType, temporality: temporality}
+						out[k] = s
+					}
+					s.points = append(s.points, p)
+				}
+				forEachPoint(m, add)
+			}
+		}
+	}
+	return out
+}
+
+func describe(m *metricpb.Metric) (dataType, temporality string) {
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		return "Gauge", ""
+	case *metricpb.Metric_Sum:
+		temporality = otlptext.Temporality(data.Sum.GetAggregationTemporality())
+		if data.Sum.GetIsMonotonic() {
+			temporality += " monotonic"
+		}
+		return "Sum", temporality
+	case *metricpb.Metric_Histogram:
+		return "Histogram", otlptext.Temporality(data.Histogram.GetAggregationTemporality())
+	case *metricpb.Metric_Summary:
+		return "Summary", ""
+	}
+	return "Unsupported", ""
+}
+
+func forEachPoint(m *metricpb.Metric, fn func([]*commonpb.KeyValue, point)) {
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			fn(p.GetAttributes(), numberPoint(p))
+		}
+	case *metricpb.Metric_Sum:
+		for _, p := range data.Sum.GetDataPoints() {
+			fn(p.GetAttributes(), numberPoint(p))
+		}
+	case *metricpb.Metric_Histogram:
+		for _, p := range data.Histogram.GetDataPoints() {
+			fields := []field{
+				{"count", float64(p.GetCount())},
+				{"sum", p.GetSum()},
+			}
+			for i, b := range p.GetExplicitBounds() {
+				fields = append(fields, field{fmt.Sprintf("bound[%d]", i), b})
+			}
+			for i, c := range p.GetBucketCounts() {
+				fields = append(fields, field{fmt.Sprintf("bucket[%d]", i), float64(c)})
+			}
+			fn(p.GetAttributes(), point{p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), fields})
+		}
+	case *metricpb.Metric_Summary:
+		for _, p := range data.Summary.GetDataPoints() {
+			fields := []field{
+				{"count", float64(p.GetCount())},
+				{"sum", p.GetSum()},
+			}
+			for _, q := range p.GetQuantileValues() {
+				fields = append(fields, field{"quantile " + number(q.GetQuantile()), q.GetValue()})
+			}
+			fn(p.GetAttributes(), point{p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), fields})
+		}
+	}
+}
+
+func numberPoint(p *metricpb.NumberDataPoint) point {
+	var v float64
+	switch val := p.GetValue().(type) {
+	case *metricpb.NumberDataPoint_AsInt:
+		v = float64(val.AsInt)
+	case *metricpb.NumberDataPoint_AsDouble:
+		v = val.AsDouble
+	}
+	return point{p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), []field{{"value", v}}}
+}
@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func gaugePoint(method string, v int64, end uint64) *metricpb.NumberDataPoint {
+	return &metricpb.NumberDataPoint{
+		Attributes: []*commonpb.KeyValue{{
+			Key:   "rpc.method",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: method}},
+		}},
+		TimeUnixNano: end,
+		Value:        &metricpb.NumberDataPoint_AsInt{AsInt: v},
+	}
+}
+
+func payload(ms ...*metricpb.Metric) []*metricpb.ResourceMetrics {
+	return []*metricpb.ResourceMetrics{{InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+		InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: "test", Version: "1"},
+		Metrics:                ms,
+	}}}}
+}
+
+func gauge(name string, pts ...*metricpb.NumberDataPoint) *metricpb.Metric {
+	return &metricpb.Metric{Name: name, Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: pts}}}
+}
+
+func sum(name string, temporality metricpb.AggregationTemporality, pts ...*metricpb.NumberDataPoint) *metricpb.Metric {
+	return &metricpb.Metric{Name: name, Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+		AggregationTemporality: temporality,
+		IsMonotonic:            true,
+		DataPoints:             pts,
+	}}}
+}
+
+func histogram(name string, count uint64, buckets ...uint64) *metricpb.Metric {
+	return &metricpb.Metric{Name: name, Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+		AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		DataPoints: []*metricpb.HistogramDataPoint{{
+			Count:          count,
+			Sum:            float64(count),
+			ExplicitBounds: []float64{5},
+			BucketCounts:   buckets,
+		}},
+	}}}
+}
+
+func TestCompare(t *testing.T) {
+	const (
+		cumulative = metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		delta      = metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	)
+	for _, tc := range []struct {
+		name string
+		a, b []*metricpb.ResourceMetrics
+		opts Options
+		want []string
+	}{
+		{
+			name: "same",
+			a:    payload(gauge("g", gaugePoint("Hello", 1, 10), gaugePoint("Hi", 2, 10))),
+			b:    payload(gauge("g", gaugePoint("Hi", 2, 20), gaugePoint("Hello", 1, 20))),
+		},
+		{
+			name: "added and removed",
+			a:    payload(gauge("g", gaugePoint("Hello", 1, 10)), gauge("old", gaugePoint("Hi", 1, 10))),
+			b:    payload(gauge("g", gaugePoint("Hello", 1, 10), gaugePoint("Hi", 2, 10), gaugePoint("Hi", 3, 20))),
+			want: []string{
+				"test@1/g{rpc.method=Hi}: added: Gauge, 2 points",
+				"test@1/old{rpc.method=Hi}: removed: Gauge, 1 points",
+			},
+		},
+		{
+			name: "changed values",
+			a:    payload(gauge("g", gaugePoint("Hello", 1, 10), gaugePoint("Hello", 5, 20)), histogram("h", 1, 1, 0)),
+			b:    payload(gauge("g", gaugePoint("Hello", 3, 10)), histogram("h", 2, 1, 1)),
+			want: []string{
+				"test@1/g{rpc.method=Hello}: point count: 2 -> 1",
+				"test@1/g{rpc.method=Hello}: value: point #0 value 1 -> 3 (+2)",
+				"test@1/h{}: value: point #0 count 1 -> 2 (+1)",
+				"test@1/h{}: value: point #0 sum 1 -> 2 (+1)",
+				"test@1/h{}: value: point #0 bucket[1] 0 -> 1 (+1)",
+			},
+		},
+		{
+			name: "changed type and temporality",
+			a:    payload(gauge("g", gaugePoint("Hello", 1, 10)), sum("s", cumulative, gaugePoint("Hello", 1, 10))),
+			b:    payload(sum("g", delta, gaugePoint("Hello", 2, 10)), sum("s", delta, gaugePoint("Hello", 1, 10))),
+			want: []string{
+				"test@1/g{rpc.method=Hello}: data type: Gauge -> Sum",
+				"test@1/s{rpc.method=Hello}: temporality: CUMULATIVE monotonic -> DELTA monotonic",
+			},
+		},
+		{
+			name: "timestamps",
+			a:    payload(gauge("g", gaugePoint("Hello", 1, 10))),
+			b:    payload(gauge("g", gaugePoint("Hello", 1, 20))),
+			opts: Options{Timestamps: true},
+			want: []string{"test@1/g{rpc.method=Hello}: timestamp: point #0 time 10 -> 20"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Compare(tc.a, tc.b, tc.opts) {
+				got = append(got, c.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/capture"
+	"github.com/tyrone-anz/export-otlp-googlecloud/diff"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// runDiff compares two capture files series by series and prints what
+// changed. It fails when there are differences, like diff(1).
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	timestamps := fs.Bool("timestamps", false, "also compare point start and end times")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s diff [flags] before after\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff needs exactly two capture files")
+	}
+
+	before, err := readResourceMetrics(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := readResourceMetrics(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := diff.Compare(before, after, diff.Options{Timestamps: *timestamps})
+	resource := ""
+	for i, c := range changes {
+		if i == 0 || c.Key.Resource != resource {
+			resource = c.Key.Resource
+			fmt.Printf("resource {%s}\n", resource)
+		}
+		fmt.Printf("  %s\n", c)
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("%d differences", len(changes))
+	}
+	return nil
+}
+
+// readResourceMetrics returns the ResourceMetrics of every request in a
+// capture file, flattened in file order.
+func readResourceMetrics(filename string) ([]*metricpb.ResourceMetrics, error) {
+	reqs, err := capture.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rms []*metricpb.ResourceMetrics
+	for _, req := range reqs {
+		rms = append(rms, req.GetResourceMetrics()...)
+	}
+	return rms, nil
+}
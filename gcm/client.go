@@ -0,0 +1,44 @@
+package gcm
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+type descriptorClient struct {
+	client     otlpmetric.Client
+	cfg        Config
+	registry   *Registry
+	onConflict func(error)
+}
+
+// NewDescriptorClient wraps client so that the descriptors of every upload
+// are registered in registry before it is handed on, as the googlecloud
+// exporter does with skip_create_descriptor: false. Conflicts are passed
+// to onConflict; the upload goes ahead regardless.
+func NewDescriptorClient(client otlpmetric.Client, cfg Config, registry *Registry, onConflict func(error)) otlpmetric.Client {
+	return &descriptorClient{client: client, cfg: cfg, registry: registry, onConflict: onConflict}
+}
+
+// Start starts the wrapped client.
+func (c *descriptorClient) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *descriptorClient) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics registers the descriptors of protoMetrics and uploads them
+// with the wrapped client.
+func (c *descriptorClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	for _, d := range DescriptorsFor(c.cfg, protoMetrics) {
+		if err := c.registry.Register(d); err != nil && c.onConflict != nil {
+			c.onConflict(err)
+		}
+	}
+	return c.client.UploadMetrics(ctx, protoMetrics)
+}
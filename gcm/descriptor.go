@@ -0,0 +1,165 @@
+package gcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// MetricDescriptor mirrors the parts of google.api.MetricDescriptor that
+// the googlecloud exporter fills in when skip_create_descriptor is false.
+// Every label is a STRING label, so only the keys are kept.
+type MetricDescriptor struct {
+	Type        string     `json:"type"`
+	MetricKind  MetricKind `json:"metric_kind"`
+	ValueType   ValueType  `json:"value_type"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Labels      []string   `json:"labels,omitempty"`
+}
+
+// DescriptorsFor derives one descriptor per metric type written by the
+// payload, in order of first appearance. The labels of a descriptor are
+// the union of the label keys of its series.
+func DescriptorsFor(cfg Config, rms []*metricpb.ResourceMetrics) []MetricDescriptor {
+	var out []MetricDescriptor
+	index := make(map[string]int)
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				for _, ts := range translateMetric(cfg, MonitoredResource{}, m) {
+					i, ok := index[ts.Metric.Type]
+					if !ok {
+						i = len(out)
+						index[ts.Metric.Type] = i
+						out = append(out, MetricDescriptor{
+							Type:        ts.Metric.Type,
+							MetricKind:  ts.MetricKind,
+							ValueType:   ts.ValueType,
+							Unit:        m.GetUnit(),
+							Description: m.GetDescription(),
+						})
+					}
+					out[i].Labels = mergeLabels(out[i].Labels, ts.Metric.Labels)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func mergeLabels(keys []string, labels map[string]string) []string {
+	for k := range labels {
+		j := sort.SearchStrings(keys, k)
+		if j < len(keys) && keys[j] == k {
+			continue
+		}
+		keys = append(keys, "")
+		copy(keys[j+1:], keys[j:])
+		keys[j] = k
+	}
+	return keys
+}
+
+// ConflictError reports a descriptor that differs from the registered one
+// in a way Cloud Monitoring rejects.
+type ConflictError struct {
+	Type     string
+	Field    string
+	Existing string
+	New      string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("metric descriptor %s: %s changed from %s to %s", e.Type, e.Field, e.Existing, e.New)
+}
+
+// Registry holds the descriptors created so far, standing in for the
+// project's descriptors in Cloud Monitoring.
+type Registry struct {
+	mu          sync.Mutex
+	descriptors map[string]MetricDescriptor
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{descriptors: make(map[string]MetricDescriptor)}
+}
+
+// LoadRegistry reads a registry saved with Save. A missing file yields an
+// empty Registry.
+func LoadRegistry(filename string) (*Registry, error) {
+	r := NewRegistry()
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ds []MetricDescriptor
+	if err := json.Unmarshal(b, &ds); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, d := range ds {
+		r.descriptors[d.Type] = d
+	}
+	return r, nil
+}
+
+// Save writes the registry to filename as JSON, sorted by type.
+func (r *Registry) Save(filename string) error {
+	b, err := json.MarshalIndent(r.Descriptors(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+// Descriptors returns the registered descriptors sorted by type.
+func (r *Registry) Descriptors() []MetricDescriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]MetricDescriptor, 0, len(r.descriptors))
+	for _, d := range r.descriptors {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// Register creates d if its type is new. Otherwise it returns a
+// *ConflictError when the metric kind, value type or unit differ from the
+// registered descriptor, and leaves the registry unchanged. New label keys
+// are added to the registered descriptor, as Cloud Monitoring does for
+// automatically created custom metrics.
+func (r *Registry) Register(d MetricDescriptor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.descriptors[d.Type]
+	if !ok {
+		d.Labels = append([]string(nil), d.Labels...)
+		r.descriptors[d.Type] = d
+		return nil
+	}
+	switch {
+	case existing.MetricKind != d.MetricKind:
+		return &ConflictError{d.Type, "metric kind", existing.MetricKind.String(), d.MetricKind.String()}
+	case existing.ValueType != d.ValueType:
+		return &ConflictError{d.Type, "value type", existing.ValueType.String(), d.ValueType.String()}
+	case existing.Unit != d.Unit:
+		return &ConflictError{d.Type, "unit", fmt.Sprintf("%q", existing.Unit), fmt.Sprintf("%q", d.Unit)}
+	}
+	for _, k := range d.Labels {
+		existing.Labels = mergeLabels(existing.Labels, map[string]string{k: ""})
+	}
+	r.descriptors[d.Type] = existing
+	return nil
+}
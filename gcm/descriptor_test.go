@@ -0,0 +1,137 @@
+package gcm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func TestDescriptorsFor(t *testing.T) {
+	payload := case1()
+	payload[0].InstrumentationLibraryMetrics[0].Metrics[0].Unit = "ms"
+	got := DescriptorsFor(Config{PointAttributes: true}, payload)
+	want := []MetricDescriptor{
+		{Type: DefaultPrefix + "/test.dummy.one_summary_count", MetricKind: Cumulative, ValueType: Int64, Unit: "ms", Labels: []string{"rpc_method"}},
+		{Type: DefaultPrefix + "/test.dummy.one_summary_sum", MetricKind: Cumulative, ValueType: Double, Unit: "ms", Labels: []string{"rpc_method"}},
+		{Type: DefaultPrefix + "/test.dummy.one_summary_percentile", MetricKind: Gauge, ValueType: Double, Unit: "ms", Labels: []string{"percentile", "rpc_method"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const typ = DefaultPrefix + "/test.dummy.one"
+	base := MetricDescriptor{Type: typ, MetricKind: Gauge, ValueType: Int64, Unit: "ms", Labels: []string{"b"}}
+	for _, tc := range []struct {
+		name string
+		d    MetricDescriptor
+		want error
+		// labels are those registered afterwards.
+		labels []string
+	}{
+		{name: "same", d: base, labels: []string{"b"}},
+		{
+			name:   "new labels",
+			d:      MetricDescriptor{Type: typ, MetricKind: Gauge, ValueType: Int64, Unit: "ms", Labels: []string{"a", "c"}},
+			labels: []string{"a", "b", "c"},
+		},
+		{
+			name:   "metric kind",
+			d:      MetricDescriptor{Type: typ, MetricKind: Cumulative, ValueType: Int64, Unit: "ms"},
+			want:   &ConflictError{typ, "metric kind", "GAUGE", "CUMULATIVE"},
+			labels: []string{"b"},
+		},
+		{
+			name:   "value type",
+			d:      MetricDescriptor{Type: typ, MetricKind: Gauge, ValueType: Double, Unit: "ms"},
+			want:   &ConflictError{typ, "value type", "INT64", "DOUBLE"},
+			labels: []string{"b"},
+		},
+		{
+			name:   "unit",
+			d:      MetricDescriptor{Type: typ, MetricKind: Gauge, ValueType: Int64, Unit: "s", Labels: []string{"a"}},
+			want:   &ConflictError{typ, "unit", `"ms"`, `"s"`},
+			labels: []string{"b"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			if err := r.Register(base); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Register(tc.d); !reflect.DeepEqual(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			ds := r.Descriptors()
+			if len(ds) != 1 || ds[0].MetricKind != Gauge || !reflect.DeepEqual(ds[0].Labels, tc.labels) {
+				t.Errorf("registered %+v, want the original with labels %v", ds, tc.labels)
+			}
+		})
+	}
+}
+
+func TestRegistrySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "descriptors.json")
+
+	r, err := LoadRegistry(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range DescriptorsFor(Config{}, case3()) {
+		if err := r.Register(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRegistry(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Descriptors(), r.Descriptors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+type nopClient struct{ uploads int }
+
+func (c *nopClient) Start(context.Context) error { return nil }
+func (c *nopClient) Stop(context.Context) error  { return nil }
+func (c *nopClient) UploadMetrics(context.Context, []*metricpb.ResourceMetrics) error {
+	c.uploads++
+	return nil
+}
+
+func TestDescriptorClient(t *testing.T) {
+	ctx := context.Background()
+	next := &nopClient{}
+	var conflicts []error
+	client := NewDescriptorClient(next, Config{}, NewRegistry(), func(err error) { conflicts = append(conflicts, err) })
+
+	// The same metric as a gauge and then as a delta distribution.
+	for _, payload := range [][]*metricpb.ResourceMetrics{case2(), case3()} {
+		if err := client.UploadMetrics(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.uploads != 2 {
+		t.Errorf("got %d uploads, want 2 despite the conflict", next.uploads)
+	}
+	var ce *ConflictError
+	if len(conflicts) != 1 || !errors.As(conflicts[0], &ce) || ce.Field != "metric kind" {
+		t.Errorf("got conflicts %v, want one of metric kind", conflicts)
+	}
+}
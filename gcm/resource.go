@@ -0,0 +1,97 @@
+package gcm
+
+import (
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// Resource attribute keys from the OpenTelemetry semantic conventions that
+// MonitoredResourceFor looks at.
+const (
+	attrCloudProvider     = "cloud.provider"
+	attrCloudAccountID    = "cloud.account.id"
+	attrCloudZone         = "cloud.availability_zone"
+	attrCloudZoneLegacy   = "cloud.zone"
+	attrCloudRegion       = "cloud.region"
+	attrHostID            = "host.id"
+	attrHostName          = "host.name"
+	attrK8SCluster        = "k8s.cluster.name"
+	attrK8SNamespace      = "k8s.namespace.name"
+	attrK8SPod            = "k8s.pod.name"
+	attrK8SContainer      = "k8s.container.name"
+	attrServiceName       = "service.name"
+	attrServiceNamespace  = "service.namespace"
+	attrServiceInstanceID = "service.instance.id"
+)
+
+// MonitoredResourceFor maps OTel resource attributes onto the first
+// monitored resource type whose required labels they provide:
+//
+//	k8s_container  k8s.cluster.name, k8s.namespace.name, k8s.pod.name, k8s.container.name
+//	gce_instance   cloud.provider=gcp, host.id, cloud.availability_zone
+//	generic_task   service.name, service.instance.id
+//	generic_node   host.id or host.name
+//	global         anything else
+//
+// cloud.account.id is used as the project when cfg.ProjectID is empty.
+// Locations fall back from zone to region to "global".
+func MonitoredResourceFor(cfg Config, attrs []*commonpb.KeyValue) MonitoredResource {
+	a := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		a[kv.GetKey()] = otlptext.Value(kv.GetValue())
+	}
+
+	project := cfg.ProjectID
+	if project == "" {
+		project = a[attrCloudAccountID]
+	}
+	zone := a[attrCloudZone]
+	if zone == "" {
+		zone = a[attrCloudZoneLegacy]
+	}
+	location := zone
+	if location == "" {
+		location = a[attrCloudRegion]
+	}
+	if location == "" {
+		location = "global"
+	}
+
+	switch {
+	case a[attrK8SCluster] != "" && a[attrK8SNamespace] != "" && a[attrK8SPod] != "" && a[attrK8SContainer] != "":
+		return MonitoredResource{Type: "k8s_container", Labels: map[string]string{
+			"project_id":     project,
+			"location":       location,
+			"cluster_name":   a[attrK8SCluster],
+			"namespace_name": a[attrK8SNamespace],
+			"pod_name":       a[attrK8SPod],
+			"container_name": a[attrK8SContainer],
+		}}
+	case a[attrCloudProvider] == "gcp" && a[attrHostID] != "" && zone != "":
+		return MonitoredResource{Type: "gce_instance", Labels: map[string]string{
+			"project_id":  project,
+			"instance_id": a[attrHostID],
+			"zone":        zone,
+		}}
+	case a[attrServiceName] != "" && a[attrServiceInstanceID] != "":
+		return MonitoredResource{Type: "generic_task", Labels: map[string]string{
+			"project_id": project,
+			"location":   location,
+			"namespace":  a[attrServiceNamespace],
+			"job":        a[attrServiceName],
+			"task_id":    a[attrServiceInstanceID],
+		}}
+	case a[attrHostID] != "" || a[attrHostName] != "":
+		node := a[attrHostID]
+		if node == "" {
+			node = a[attrHostName]
+		}
+		return MonitoredResource{Type: "generic_node", Labels: map[string]string{
+			"project_id": project,
+			"location":   location,
+			"namespace":  a[attrServiceNamespace],
+			"node_id":    node,
+		}}
+	}
+	return MonitoredResource{Type: "global", Labels: map[string]string{"project_id": project}}
+}
@@ -0,0 +1,92 @@
+package gcm
+
+import (
+	"reflect"
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+func resourceAttrs(kvs ...string) []*commonpb.KeyValue {
+	var attrs []*commonpb.KeyValue
+	for i := 0; i+1 < len(kvs); i += 2 {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   kvs[i],
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kvs[i+1]}},
+		})
+	}
+	return attrs
+}
+
+func TestMonitoredResourceFor(t *testing.T) {
+	k8s := []string{
+		"k8s.cluster.name", "prod",
+		"k8s.namespace.name", "default",
+		"k8s.pod.name", "api-0",
+		"k8s.container.name", "api",
+	}
+	for _, tc := range []struct {
+		name  string
+		cfg   Config
+		attrs []string
+		want  MonitoredResource
+	}{
+		{
+			name:  "k8s_container",
+			attrs: append([]string{"cloud.account.id", "acct", "cloud.availability_zone", "europe-west1-b"}, k8s...),
+			want: MonitoredResource{Type: "k8s_container", Labels: map[string]string{
+				"project_id": "acct", "location": "europe-west1-b", "cluster_name": "prod",
+				"namespace_name": "default", "pod_name": "api-0", "container_name": "api",
+			}},
+		},
+		{
+			name:  "k8s_container without a container",
+			attrs: append([]string{"host.name", "node-1"}, k8s[:6]...),
+			want: MonitoredResource{Type: "generic_node", Labels: map[string]string{
+				"project_id": "", "location": "global", "namespace": "", "node_id": "node-1",
+			}},
+		},
+		{
+			name:  "gce_instance",
+			cfg:   Config{ProjectID: "proj"},
+			attrs: []string{"cloud.provider", "gcp", "cloud.account.id", "acct", "host.id", "123", "cloud.zone", "us-east1-c"},
+			want: MonitoredResource{Type: "gce_instance", Labels: map[string]string{
+				"project_id": "proj", "instance_id": "123", "zone": "us-east1-c",
+			}},
+		},
+		{
+			name:  "gce_instance needs a zone",
+			attrs: []string{"cloud.provider", "gcp", "host.id", "123", "cloud.region", "us-east1"},
+			want: MonitoredResource{Type: "generic_node", Labels: map[string]string{
+				"project_id": "", "location": "us-east1", "namespace": "", "node_id": "123",
+			}},
+		},
+		{
+			name:  "generic_task",
+			attrs: []string{"service.name", "api", "service.namespace", "shop", "service.instance.id", "i-1", "host.id", "123"},
+			want: MonitoredResource{Type: "generic_task", Labels: map[string]string{
+				"project_id": "", "location": "global", "namespace": "shop", "job": "api", "task_id": "i-1",
+			}},
+		},
+		{
+			name:  "generic_node",
+			attrs: []string{"host.id", "123", "host.name", "node-1", "cloud.region", "us-east1"},
+			want: MonitoredResource{Type: "generic_node", Labels: map[string]string{
+				"project_id": "", "location": "us-east1", "namespace": "", "node_id": "123",
+			}},
+		},
+		{
+			// What main.go's payloads carry.
+			name:  "global",
+			attrs: []string{"service.name", "unknown_service:___go_build_main_go"},
+			want:  MonitoredResource{Type: "global", Labels: map[string]string{"project_id": ""}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MonitoredResourceFor(tc.cfg, resourceAttrs(tc.attrs...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
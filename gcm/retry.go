@@ -0,0 +1,119 @@
+package gcm
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/status"
+)
+
+// partialFailurePrefix starts the message of a CreateTimeSeries request
+// that was partially written.
+const partialFailurePrefix = "One or more TimeSeries could not be written: "
+
+// seriesRef ends each reason of a partial failure with the indexes it
+// applies to, like "timeSeries[3]" or "timeSeries[0-2,5]".
+var seriesRef = regexp.MustCompile(`: timeSeries\[([0-9,\- ]+)\](?:; |$)`)
+
+// Classify is an otlpclient.RetryClassifier for errors in the format
+// Cloud Monitoring uses when a CreateTimeSeries request was partially
+// written, whatever their gRPC code. Each reason is mapped back from the
+// time series index to the OTLP point it was translated from:
+// reasons asking to retry, such as ReasonInternal, are retried and every
+// other reason is fatal. Summaries translate into several series; a point
+// is retried if any of its series may be. Other errors are classified by
+// otlpclient.DefaultClassifier.
+//
+// The indexes are only meaningful if the request reached Cloud Monitoring
+// with the time series in Translate order, as the googlecloud exporter
+// sends a single OTLP request.
+func Classify(err error, protoMetrics []*metricpb.ResourceMetrics) otlpclient.Classification {
+	st, ok := status.FromError(err)
+	if !ok || !strings.HasPrefix(st.Message(), partialFailurePrefix) {
+		return otlpclient.DefaultClassifier(err, protoMetrics)
+	}
+
+	points := pointIndexes(protoMetrics)
+	failures := make(map[int]int)
+	c := otlpclient.Classification{Verdict: otlpclient.Fatal, Delay: otlpclient.RetryDelay(st)}
+	msg := strings.TrimPrefix(st.Message(), partialFailurePrefix)
+	start := 0
+	for _, m := range seriesRef.FindAllStringSubmatchIndex(msg, -1) {
+		reason := msg[start:m[0]]
+		start = m[1]
+		verdict := otlpclient.Fatal
+		if strings.Contains(reason, "Please retry") {
+			verdict = otlpclient.Retry
+		}
+		for _, ts := range parseIndexes(msg[m[2]:m[3]]) {
+			if ts < 0 || ts >= len(points) {
+				continue
+			}
+			p := points[ts]
+			if i, ok := failures[p]; ok {
+				if verdict == otlpclient.Retry {
+					c.Points[i].Verdict, c.Points[i].Reason = verdict, reason
+				}
+				continue
+			}
+			failures[p] = len(c.Points)
+			c.Points = append(c.Points, otlpclient.PointFailure{Index: p, Verdict: verdict, Reason: reason})
+		}
+	}
+	if len(c.Points) == 0 {
+		return otlpclient.DefaultClassifier(err, protoMetrics)
+	}
+	return c
+}
+
+// pointIndexes returns, for each time series Translate makes of rms, the
+// index of the OTLP point it came from.
+func pointIndexes(rms []*metricpb.ResourceMetrics) []int {
+	var out []int
+	point := 0
+	add := func(n int) {
+		for i := 0; i < n; i++ {
+			out = append(out, point)
+		}
+		point++
+	}
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				for _, p := range otlpclient.Points(m) {
+					if sp, ok := p.(*metricpb.SummaryDataPoint); ok {
+						// _summary_count, _summary_sum and one percentile each.
+						add(2 + len(sp.GetQuantileValues()))
+					} else {
+						add(1)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// parseIndexes expands a list like "0-2,5" into its indexes.
+func parseIndexes(list string) []int {
+	var out []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for i := from; i <= to; i++ {
+			out = append(out, i)
+		}
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package gcm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlphttp"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryPayload holds two summary points with two quantiles each, written
+// as time series 0-3 and 4-7, and one gauge point, series 8.
+func retryPayload() []*metricpb.ResourceMetrics {
+	rms := case1()
+	gauge := case2()[0].InstrumentationLibraryMetrics[0].Metrics[0]
+	gauge.GetGauge().DataPoints = gauge.GetGauge().DataPoints[:1]
+	rms[0].InstrumentationLibraryMetrics[0].Metrics = append(rms[0].InstrumentationLibraryMetrics[0].Metrics, gauge)
+	return rms
+}
+
+func TestPointIndexes(t *testing.T) {
+	rms := retryPayload()
+
+	want := []int{0, 0, 0, 0, 1, 1, 1, 1, 2}
+	if got := pointIndexes(rms); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if n := len(SeriesFor(Config{}, rms)); n != len(want) {
+		t.Errorf("Translate wrote %d series, want %d", n, len(want))
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	for _, tc := range []struct {
+		list string
+		want []int
+	}{
+		{list: "3", want: []int{3}},
+		{list: "0-2,5", want: []int{0, 1, 2, 5}},
+		{list: " 1 , 4-5", want: []int{1, 4, 5}},
+		{list: "x,2", want: []int{2}},
+		{list: "", want: nil},
+	} {
+		if got := parseIndexes(tc.list); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseIndexes(%q): got %v, want %v", tc.list, got, tc.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	reason := func(r, list string) string {
+		return r + ": timeSeries[" + list + "]"
+	}
+	rms := retryPayload()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want otlpclient.Classification
+	}{
+		{
+			name: "range",
+			err: status.Error(codes.InvalidArgument, partialFailurePrefix+
+				reason(ReasonDuplicate, "0-2,5")),
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal, Points: []otlpclient.PointFailure{
+				{Index: 0, Verdict: otlpclient.Fatal, Reason: ReasonDuplicate},
+				{Index: 1, Verdict: otlpclient.Fatal, Reason: ReasonDuplicate},
+			}},
+		},
+		{
+			name: "duplicate then internal on one point",
+			err: status.Error(codes.Internal, partialFailurePrefix+
+				reason(ReasonDuplicate, "1")+"; "+reason(ReasonInternal, "2")),
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal, Points: []otlpclient.PointFailure{
+				{Index: 0, Verdict: otlpclient.Retry, Reason: ReasonInternal},
+			}},
+		},
+		{
+			name: "internal then duplicate on one point",
+			err: status.Error(codes.Internal, partialFailurePrefix+
+				reason(ReasonInternal, "5")+"; "+reason(ReasonDuplicate, "6")),
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal, Points: []otlpclient.PointFailure{
+				{Index: 1, Verdict: otlpclient.Retry, Reason: ReasonInternal},
+			}},
+		},
+		{
+			name: "summary percentile and gauge",
+			err: status.Error(codes.InvalidArgument, partialFailurePrefix+
+				reason(ReasonDuplicate, "7")+"; "+reason(ReasonOutOfOrder, "8")),
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal, Points: []otlpclient.PointFailure{
+				{Index: 1, Verdict: otlpclient.Fatal, Reason: ReasonDuplicate},
+				{Index: 2, Verdict: otlpclient.Fatal, Reason: ReasonOutOfOrder},
+			}},
+		},
+		{
+			name: "index out of range",
+			err: status.Error(codes.InvalidArgument, partialFailurePrefix+
+				reason(ReasonDuplicate, "9")),
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal},
+		},
+		{
+			name: "over HTTP",
+			err: &otlphttp.StatusError{StatusCode: 500, Status: status.New(codes.Internal, partialFailurePrefix+
+				reason(ReasonInternal, "8")).Proto()},
+			want: otlpclient.Classification{Verdict: otlpclient.Fatal, Points: []otlpclient.PointFailure{
+				{Index: 2, Verdict: otlpclient.Retry, Reason: ReasonInternal},
+			}},
+		},
+		{
+			name: "HTTP throttled",
+			err:  &otlphttp.StatusError{StatusCode: 429, RetryAfter: 2 * time.Second},
+			want: otlpclient.Classification{Verdict: otlpclient.Retry, Delay: 2 * time.Second},
+		},
+		{
+			name: "not a partial failure",
+			err:  status.Error(codes.Unavailable, "connection refused"),
+			want: otlpclient.Classification{Verdict: otlpclient.Retry},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Classify(tc.err, rms); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
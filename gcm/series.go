@@ -0,0 +1,202 @@
+// Package gcm models the parts of Google Cloud Monitoring that the
+// collector's googlecloud exporter runs into, so that OTLP payloads can be
+// checked offline.
+package gcm
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// DefaultPrefix is the metric type prefix used when Config.Prefix is empty.
+const DefaultPrefix = "custom.googleapis.com/opencensus"
+
+// MetricKind mirrors google.api.MetricDescriptor.MetricKind.
+type MetricKind int
+
+const (
+	MetricKindUnspecified MetricKind = iota
+	Gauge
+	Delta
+	Cumulative
+)
+
+func (k MetricKind) String() string {
+	switch k {
+	case Gauge:
+		return "GAUGE"
+	case Delta:
+		return "DELTA"
+	case Cumulative:
+		return "CUMULATIVE"
+	}
+	return "METRIC_KIND_UNSPECIFIED"
+}
+
+// MarshalText encodes the kind by name.
+func (k MetricKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a name written by MarshalText.
+func (k *MetricKind) UnmarshalText(text []byte) error {
+	for _, kind := range []MetricKind{MetricKindUnspecified, Gauge, Delta, Cumulative} {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric kind %q", text)
+}
+
+// Config controls how OTLP metrics are mapped onto Cloud Monitoring.
+type Config struct {
+	// Prefix is prepended to every metric name to form the metric type,
+	// like the collector's metric.prefix setting.
+	Prefix string
+	// ProjectID is reported as the project_id label of the monitored
+	// resource. When empty, the cloud.account.id resource attribute is
+	// used instead.
+	ProjectID string
+	// PointAttributes maps data point attributes onto metric labels. The
+	// googlecloud exporter of collector v0.31.0 predates OTLP v0.9 and reads
+	// only the deprecated labels field, which the Go SDK RC1 leaves empty,
+	// so by default attributes are ignored and points that differ only in
+	// them are written to the same series. That is what Cases #1 to #3 of
+	// main.go run into.
+	PointAttributes bool
+}
+
+// Series identifies one Cloud Monitoring time series and the single point
+// written to it.
+type Series struct {
+	// Index is the position of the series in the CreateTimeSeries request.
+	Index        int
+	MetricType   string
+	MetricLabels map[string]string
+	ResourceType string
+	// ResourceLabels are the monitored resource labels.
+	ResourceLabels    map[string]string
+	Kind              MetricKind
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+}
+
+// Key returns a string that is equal for two Series exactly when Cloud
+// Monitoring treats them as the same time series.
+func (s Series) Key() string {
+	var b strings.Builder
+	b.WriteString(s.MetricType)
+	writeLabels(&b, s.MetricLabels)
+	b.WriteString(s.ResourceType)
+	writeLabels(&b, s.ResourceLabels)
+	return b.String()
+}
+
+func writeLabels(b *strings.Builder, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=%q", k, labels[k])
+	}
+	b.WriteByte('}')
+}
+
+// SeriesFor flattens the OTLP payload into time series in the order the
+// googlecloud exporter would place them in a CreateTimeSeries request. It
+// is the identity and timing of what Translate returns.
+func SeriesFor(cfg Config, rms []*metricpb.ResourceMetrics) []Series {
+	tss := Translate(cfg, rms)
+	out := make([]Series, len(tss))
+	for i, ts := range tss {
+		p := ts.Points[0]
+		out[i] = Series{
+			Index:             i,
+			MetricType:        ts.Metric.Type,
+			MetricLabels:      ts.Metric.Labels,
+			ResourceType:      ts.Resource.Type,
+			ResourceLabels:    ts.Resource.Labels,
+			Kind:              ts.MetricKind,
+			StartTimeUnixNano: p.StartTimeUnixNano,
+			TimeUnixNano:      p.EndTimeUnixNano,
+		}
+	}
+	return out
+}
+
+// SeriesKey identifies points by the time series Translate writes them
+// to, so that otlpclient.Split separates the points Cloud Monitoring would
+// reject as duplicates.
+func SeriesKey(cfg Config) otlpclient.SeriesKeyFunc {
+	return func(point []*metricpb.ResourceMetrics) string {
+		var b strings.Builder
+		for _, s := range SeriesFor(cfg, point) {
+			b.WriteString(s.Key())
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+}
+
+func metricType(prefix, name string) string {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return path.Join(prefix, name)
+}
+
+func sumKind(t metricpb.AggregationTemporality, monotonic bool) MetricKind {
+	if !monotonic {
+		return Gauge
+	}
+	if t == metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		return Delta
+	}
+	return Cumulative
+}
+
+// Labels converts OTLP attributes into Cloud Monitoring labels with
+// sanitized keys.
+func Labels(attrs []*commonpb.KeyValue) map[string]string {
+	labels := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		labels[SanitizeKey(kv.GetKey())] = otlptext.Value(kv.GetValue())
+	}
+	return labels
+}
+
+// SanitizeKey replaces characters Cloud Monitoring does not accept in
+// label keys, the same way the OpenCensus Stackdriver exporter does.
+func SanitizeKey(key string) string {
+	if key == "" {
+		return key
+	}
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, key)
+	if unicode.IsDigit(rune(s[0])) {
+		s = "key_" + s
+	}
+	if s[0] == '_' {
+		s = "key" + s
+	}
+	return s
+}
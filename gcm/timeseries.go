@@ -0,0 +1,249 @@
+package gcm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// ValueType mirrors google.api.MetricDescriptor.ValueType.
+type ValueType int
+
+const (
+	ValueTypeUnspecified ValueType = iota
+	Bool
+	Int64
+	Double
+	String
+	DistributionValue
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case Bool:
+		return "BOOL"
+	case Int64:
+		return "INT64"
+	case Double:
+		return "DOUBLE"
+	case String:
+		return "STRING"
+	case DistributionValue:
+		return "DISTRIBUTION"
+	}
+	return "VALUE_TYPE_UNSPECIFIED"
+}
+
+// MarshalText encodes the value type by name.
+func (t ValueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a name written by MarshalText.
+func (t *ValueType) UnmarshalText(text []byte) error {
+	for _, vt := range []ValueType{ValueTypeUnspecified, Bool, Int64, Double, String, DistributionValue} {
+		if vt.String() == string(text) {
+			*t = vt
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown value type %q", text)
+}
+
+// Metric mirrors google.api.Metric.
+type Metric struct {
+	Type   string
+	Labels map[string]string
+}
+
+// MonitoredResource mirrors google.api.MonitoredResource.
+type MonitoredResource struct {
+	Type   string
+	Labels map[string]string
+}
+
+// Distribution mirrors google.api.Distribution with explicit buckets.
+// OTLP histograms carry no sum of squared deviation, so it is always zero,
+// as it is in what the exporter writes.
+type Distribution struct {
+	Count                 int64
+	Mean                  float64
+	SumOfSquaredDeviation float64
+	Bounds                []float64
+	BucketCounts          []int64
+}
+
+// TypedValue mirrors google.monitoring.v3.TypedValue. Only the field
+// matching Type is set.
+type TypedValue struct {
+	Type         ValueType
+	Int64Value   int64
+	DoubleValue  float64
+	Distribution *Distribution
+}
+
+func (v TypedValue) String() string {
+	switch v.Type {
+	case Int64:
+		return strconv.FormatInt(v.Int64Value, 10)
+	case Double:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case DistributionValue:
+		d := v.Distribution
+		return fmt.Sprintf("count=%d mean=%g buckets=%v bounds=%v", d.Count, d.Mean, d.BucketCounts, d.Bounds)
+	}
+	return ""
+}
+
+// Point mirrors google.monitoring.v3.Point. The start time of gauges is
+// kept although Cloud Monitoring ignores it.
+type Point struct {
+	StartTimeUnixNano uint64
+	EndTimeUnixNano   uint64
+	Value             TypedValue
+}
+
+// TimeSeries mirrors google.monitoring.v3.TimeSeries as written by the
+// googlecloud exporter: exactly one point per series.
+type TimeSeries struct {
+	Metric     Metric
+	Resource   MonitoredResource
+	MetricKind MetricKind
+	ValueType  ValueType
+	Points     []Point
+}
+
+// String renders the series on one line, e.g.
+//
+//	custom.googleapis.com/opencensus/a{k="v"} global{project_id=""} GAUGE INT64 03:20:57 20
+func (ts TimeSeries) String() string {
+	var b strings.Builder
+	b.WriteString(ts.Metric.Type)
+	writeLabels(&b, ts.Metric.Labels)
+	b.WriteByte(' ')
+	b.WriteString(ts.Resource.Type)
+	writeLabels(&b, ts.Resource.Labels)
+	fmt.Fprintf(&b, " %s %s", ts.MetricKind, ts.ValueType)
+	for _, p := range ts.Points {
+		end := time.Unix(0, int64(p.EndTimeUnixNano)).UTC()
+		if ts.MetricKind == Gauge {
+			fmt.Fprintf(&b, " %s", end.Format("15:04:05.999999999"))
+		} else {
+			start := time.Unix(0, int64(p.StartTimeUnixNano)).UTC()
+			fmt.Fprintf(&b, " %s..%s", start.Format("15:04:05.999999999"), end.Format("15:04:05.999999999"))
+		}
+		fmt.Fprintf(&b, " %s", p.Value)
+	}
+	return b.String()
+}
+
+// Translate converts the OTLP payload into time series in the order the
+// googlecloud exporter would place them in a CreateTimeSeries request.
+// Each resource is mapped with MonitoredResourceFor and each point labelled
+// as Config.PointAttributes says.
+//
+// Non-monotonic sums become gauges. Histograms become distributions with
+// explicit bounds. Summaries are expanded into cumulative _summary_count
+// and _summary_sum series and one _summary_percentile gauge per quantile,
+// labelled with the percentile.
+func Translate(cfg Config, rms []*metricpb.ResourceMetrics) []TimeSeries {
+	var out []TimeSeries
+	for _, rm := range rms {
+		res := MonitoredResourceFor(cfg, rm.GetResource().GetAttributes())
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				out = append(out, translateMetric(cfg, res, m)...)
+			}
+		}
+	}
+	return out
+}
+
+func translateMetric(cfg Config, res MonitoredResource, m *metricpb.Metric) []TimeSeries {
+	var out []TimeSeries
+	mtype := metricType(cfg.Prefix, m.GetName())
+	add := func(suffix string, p otlpclient.DataPoint, kind MetricKind, start, end uint64, v TypedValue) map[string]string {
+		labels := pointLabels(cfg, p)
+		out = append(out, TimeSeries{
+			Metric:     Metric{Type: mtype + suffix, Labels: labels},
+			Resource:   res,
+			MetricKind: kind,
+			ValueType:  v.Type,
+			Points:     []Point{{StartTimeUnixNano: start, EndTimeUnixNano: end, Value: v}},
+		})
+		return labels
+	}
+
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			add("", p, Gauge, p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), numberValue(p))
+		}
+	case *metricpb.Metric_Sum:
+		kind := sumKind(data.Sum.GetAggregationTemporality(), data.Sum.GetIsMonotonic())
+		for _, p := range data.Sum.GetDataPoints() {
+			add("", p, kind, p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), numberValue(p))
+		}
+	case *metricpb.Metric_Histogram:
+		kind := sumKind(data.Histogram.GetAggregationTemporality(), true)
+		for _, p := range data.Histogram.GetDataPoints() {
+			add("", p, kind, p.GetStartTimeUnixNano(), p.GetTimeUnixNano(), TypedValue{
+				Type:         DistributionValue,
+				Distribution: distribution(p),
+			})
+		}
+	case *metricpb.Metric_Summary:
+		for _, p := range data.Summary.GetDataPoints() {
+			start, end := p.GetStartTimeUnixNano(), p.GetTimeUnixNano()
+			add("_summary_count", p, Cumulative, start, end, TypedValue{Type: Int64, Int64Value: int64(p.GetCount())})
+			add("_summary_sum", p, Cumulative, start, end, TypedValue{Type: Double, DoubleValue: p.GetSum()})
+			for _, q := range p.GetQuantileValues() {
+				labels := add("_summary_percentile", p, Gauge, start, end, TypedValue{Type: Double, DoubleValue: q.GetValue()})
+				labels["percentile"] = strconv.FormatFloat(q.GetQuantile()*100, 'f', -1, 64)
+			}
+		}
+	}
+	return out
+}
+
+// pointLabels returns the metric labels of p: its attributes when
+// cfg.PointAttributes is set, and otherwise its deprecated labels field.
+func pointLabels(cfg Config, p otlpclient.DataPoint) map[string]string {
+	if cfg.PointAttributes {
+		return Labels(p.GetAttributes())
+	}
+	labels := make(map[string]string, len(p.GetLabels()))
+	for _, kv := range p.GetLabels() {
+		labels[SanitizeKey(kv.GetKey())] = kv.GetValue()
+	}
+	return labels
+}
+
+func numberValue(p *metricpb.NumberDataPoint) TypedValue {
+	switch v := p.GetValue().(type) {
+	case *metricpb.NumberDataPoint_AsInt:
+		return TypedValue{Type: Int64, Int64Value: v.AsInt}
+	case *metricpb.NumberDataPoint_AsDouble:
+		return TypedValue{Type: Double, DoubleValue: v.AsDouble}
+	}
+	return TypedValue{}
+}
+
+func distribution(p *metricpb.HistogramDataPoint) *Distribution {
+	d := &Distribution{
+		Count:        int64(p.GetCount()),
+		Bounds:       append([]float64(nil), p.GetExplicitBounds()...),
+		BucketCounts: make([]int64, len(p.GetBucketCounts())),
+	}
+	if d.Count > 0 {
+		d.Mean = p.GetSum() / float64(d.Count)
+	}
+	for i, c := range p.GetBucketCounts() {
+		d.BucketCounts[i] = int64(c)
+	}
+	return d
+}
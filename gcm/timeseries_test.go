@@ -0,0 +1,96 @@
+package gcm
+
+import (
+	"strings"
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func sumPayload(temporality metricpb.AggregationTemporality, monotonic bool) []*metricpb.ResourceMetrics {
+	return casePayload(&metricpb.Metric{Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+		DataPoints: []*metricpb.NumberDataPoint{{
+			Attributes:        methodAttrs("Hello"),
+			Labels:            []*commonpb.StringKeyValue{{Key: "rpc.method", Value: "Hello"}},
+			StartTimeUnixNano: caseStart,
+			TimeUnixNano:      caseEnd,
+			Value:             &metricpb.NumberDataPoint_AsDouble{AsDouble: 1.5},
+		}},
+	}}})
+}
+
+func TestTranslate(t *testing.T) {
+	const resource = ` global{project_id=""}`
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		payload []*metricpb.ResourceMetrics
+		want    []string
+	}{
+		{
+			name:    "summary",
+			payload: case1(),
+			want: []string{
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_count{}` + resource + ` CUMULATIVE INT64 03:33:07.74398..03:33:09.746479 1`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_sum{}` + resource + ` CUMULATIVE DOUBLE 03:33:07.74398..03:33:09.746479 100`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_percentile{percentile="0"}` + resource + ` GAUGE DOUBLE 03:33:09.746479 100`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_percentile{percentile="100"}` + resource + ` GAUGE DOUBLE 03:33:09.746479 100`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_count{}` + resource + ` CUMULATIVE INT64 03:33:07.74398..03:33:09.746479 1`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_sum{}` + resource + ` CUMULATIVE DOUBLE 03:33:07.74398..03:33:09.746479 20`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_percentile{percentile="0"}` + resource + ` GAUGE DOUBLE 03:33:09.746479 20`,
+				`custom.googleapis.com/opencensus/test.dummy.one_summary_percentile{percentile="100"}` + resource + ` GAUGE DOUBLE 03:33:09.746479 20`,
+			},
+		},
+		{
+			name:    "gauge with point attributes",
+			cfg:     Config{Prefix: "workload.googleapis.com", PointAttributes: true},
+			payload: case2(),
+			want: []string{
+				`workload.googleapis.com/test.dummy.one{rpc_method="Hello"}` + resource + ` GAUGE INT64 03:33:09.746479 100`,
+				`workload.googleapis.com/test.dummy.one{rpc_method="Hi"}` + resource + ` GAUGE INT64 03:33:09.746479 20`,
+			},
+		},
+		{
+			name:    "delta histogram",
+			payload: case3(),
+			want: []string{
+				`custom.googleapis.com/opencensus/test.dummy.one{}` + resource + ` DELTA DISTRIBUTION 03:33:07.74398..03:33:09.746479 count=1 mean=100 buckets=[1 0 0] bounds=[5000 10000]`,
+				`custom.googleapis.com/opencensus/test.dummy.one{}` + resource + ` DELTA DISTRIBUTION 03:33:07.74398..03:33:09.746479 count=1 mean=20 buckets=[1 0 0] bounds=[5000 10000]`,
+			},
+		},
+		{
+			name:    "cumulative sum with deprecated labels",
+			payload: sumPayload(metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true),
+			want: []string{
+				`custom.googleapis.com/opencensus/test.dummy.one{rpc_method="Hello"}` + resource + ` CUMULATIVE DOUBLE 03:33:07.74398..03:33:09.746479 1.5`,
+			},
+		},
+		{
+			name:    "delta sum",
+			payload: sumPayload(metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true),
+			want: []string{
+				`custom.googleapis.com/opencensus/test.dummy.one{rpc_method="Hello"}` + resource + ` DELTA DOUBLE 03:33:07.74398..03:33:09.746479 1.5`,
+			},
+		},
+		{
+			name:    "non-monotonic sum",
+			payload: sumPayload(metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, false),
+			want: []string{
+				`custom.googleapis.com/opencensus/test.dummy.one{rpc_method="Hello"}` + resource + ` GAUGE DOUBLE 03:33:09.746479 1.5`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, ts := range Translate(tc.cfg, tc.payload) {
+				got = append(got, ts.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
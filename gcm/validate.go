@@ -0,0 +1,165 @@
+package gcm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons reported by Cloud Monitoring for rejected time series.
+const (
+	ReasonDuplicate     = "Duplicate TimeSeries encountered. Only one point can be written per TimeSeries per request."
+	ReasonMissingStart  = "The start time must be specified for CUMULATIVE and DELTA metrics."
+	ReasonStartAfterEnd = "The start time must be before the end time for CUMULATIVE and DELTA metrics."
+	ReasonOutOfOrder    = "Points must be written in order. One or more of the points specified had an older start time than the most recent point."
+	ReasonInternal      = "Internal error encountered. Please retry after a few seconds. If internal errors persist, contact support at https://cloud.google.com/support/docs."
+)
+
+// FieldError describes why a single time series in a request was rejected.
+type FieldError struct {
+	Index  int
+	Field  string
+	Reason string
+}
+
+// Error formats e as Cloud Monitoring does. Internal errors are not about
+// a field and name only the series.
+func (e FieldError) Error() string {
+	if e.Reason == ReasonInternal {
+		return fmt.Sprintf("%s: timeSeries[%d]", e.Reason, e.Index)
+	}
+	return fmt.Sprintf("Field %s had an invalid value: %s: timeSeries[%d]", e.Field, e.Reason, e.Index)
+}
+
+// Error is returned by Validator.Validate when one or more time series of
+// a request would be rejected. It converts to an InvalidArgument gRPC
+// status, or Internal when any series failed with ReasonInternal.
+type Error struct {
+	Errors []FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Error()
+	}
+	return "One or more TimeSeries could not be written: " + strings.Join(parts, "; ")
+}
+
+// GRPCStatus lets status.FromError and status.Code recognise the error.
+func (e *Error) GRPCStatus() *status.Status {
+	code := codes.InvalidArgument
+	for _, fe := range e.Errors {
+		if fe.Reason == ReasonInternal {
+			code = codes.Internal
+		}
+	}
+	st := status.New(code, e.Error())
+	br := &errdetails.BadRequest{}
+	for _, fe := range e.Errors {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Description: fe.Reason,
+		})
+	}
+	if detailed, err := st.WithDetails(br); err == nil {
+		return detailed
+	}
+	return st
+}
+
+// Validator applies the CreateTimeSeries rules to OTLP payloads. It
+// remembers the last point written to each series so that out-of-order
+// writes across requests are detected.
+type Validator struct {
+	cfg Config
+
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+// NewValidator returns a Validator for the given mapping configuration.
+func NewValidator(cfg Config) *Validator {
+	return &Validator{
+		cfg:  cfg,
+		last: make(map[string]uint64),
+	}
+}
+
+// Validate treats rms as one CreateTimeSeries request. It returns nil when
+// every series would be written, or an *Error listing the rejected
+// indexes. As with Cloud Monitoring, the valid series of a partially
+// rejected request are still recorded as written.
+func (v *Validator) Validate(rms []*metricpb.ResourceMetrics) error {
+	return v.validate(rms, false)
+}
+
+// Write is Validate as the live backend behaves: the first point of a
+// duplicated series also fails, with ReasonInternal, and is not recorded
+// as written. This is the mix of errors seen in Cases #2 and #3 of
+// main.go.
+func (v *Validator) Write(rms []*metricpb.ResourceMetrics) error {
+	return v.validate(rms, true)
+}
+
+func (v *Validator) validate(rms []*metricpb.ResourceMetrics, failFirst bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var errs []FieldError
+	reject := func(s Series, field, reason string) {
+		errs = append(errs, FieldError{
+			Index:  s.Index,
+			Field:  fmt.Sprintf("timeSeries[%d]%s", s.Index, field),
+			Reason: reason,
+		})
+	}
+
+	seen := make(map[string]bool)
+	// first and prev remember the first occurrence of each written series
+	// and the point it replaced, so that failFirst can undo it.
+	first := make(map[string]*Series)
+	prev := make(map[string]uint64)
+	for _, s := range SeriesFor(v.cfg, rms) {
+		s := s
+		key := s.Key()
+		switch {
+		case seen[key]:
+			reject(s, "", ReasonDuplicate)
+			if f := first[key]; failFirst && f != nil {
+				reject(*f, "", ReasonInternal)
+				v.last[key] = prev[key]
+				first[key] = nil
+			}
+			continue
+		case s.Kind != Gauge && s.StartTimeUnixNano == 0:
+			reject(s, ".points[0].interval.start_time", ReasonMissingStart)
+		case s.Kind != Gauge && s.StartTimeUnixNano > s.TimeUnixNano:
+			reject(s, ".points[0].interval.start_time", ReasonStartAfterEnd)
+		case s.TimeUnixNano <= v.last[key]:
+			reject(s, "", ReasonOutOfOrder)
+		default:
+			first[key], prev[key] = &s, v.last[key]
+			v.last[key] = s.TimeUnixNano
+		}
+		seen[key] = true
+	}
+
+	if len(errs) > 0 {
+		return &Error{Errors: errs}
+	}
+	return nil
+}
+
+// Reset forgets every previously written point.
+func (v *Validator) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.last = make(map[string]uint64)
+}
@@ -0,0 +1,165 @@
+package gcm
+
+import (
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors the googlecloud exporter logged for Cases #1 to #3 of main.go.
+const (
+	case1Error = "One or more TimeSeries could not be written: " +
+		"Field timeSeries[4] had an invalid value: " + ReasonDuplicate + ": timeSeries[4]; " +
+		"Field timeSeries[5] had an invalid value: " + ReasonDuplicate + ": timeSeries[5]; " +
+		"Field timeSeries[6] had an invalid value: " + ReasonDuplicate + ": timeSeries[6]; " +
+		"Field timeSeries[7] had an invalid value: " + ReasonDuplicate + ": timeSeries[7]"
+	case2and3Error = "One or more TimeSeries could not be written: " +
+		"Field timeSeries[1] had an invalid value: " + ReasonDuplicate + ": timeSeries[1]; " +
+		ReasonInternal + ": timeSeries[0]"
+)
+
+// Timestamps of the payloads in main.go.
+const (
+	caseStart = 1629948787743980000
+	caseEnd   = 1629948789746479000
+)
+
+func methodAttrs(method string) []*commonpb.KeyValue {
+	return []*commonpb.KeyValue{{
+		Key:   "rpc.method",
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: method}},
+	}}
+}
+
+func casePayload(m *metricpb.Metric) []*metricpb.ResourceMetrics {
+	m.Name = "test.dummy.one"
+	return []*metricpb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{
+			Key:   "service.name",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "unknown_service:___go_build_main_go"}},
+		}}},
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricpb.Metric{m},
+		}},
+	}}
+}
+
+// case1 is the summary the inexpensive selector produced.
+func case1() []*metricpb.ResourceMetrics {
+	point := func(method string, v float64) *metricpb.SummaryDataPoint {
+		return &metricpb.SummaryDataPoint{
+			Attributes:        methodAttrs(method),
+			StartTimeUnixNano: caseStart,
+			TimeUnixNano:      caseEnd,
+			Count:             1,
+			Sum:               v,
+			QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{
+				{Quantile: 0, Value: v},
+				{Quantile: 1, Value: v},
+			},
+		}
+	}
+	return casePayload(&metricpb.Metric{Data: &metricpb.Metric_Summary{Summary: &metricpb.Summary{
+		DataPoints: []*metricpb.SummaryDataPoint{point("Hello", 100), point("Hi", 20)},
+	}}})
+}
+
+// case2 is the gauge the exact selector produced.
+func case2() []*metricpb.ResourceMetrics {
+	point := func(method string, v int64) *metricpb.NumberDataPoint {
+		return &metricpb.NumberDataPoint{
+			Attributes:        methodAttrs(method),
+			StartTimeUnixNano: caseStart,
+			TimeUnixNano:      caseEnd,
+			Value:             &metricpb.NumberDataPoint_AsInt{AsInt: v},
+		}
+	}
+	return casePayload(&metricpb.Metric{Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+		DataPoints: []*metricpb.NumberDataPoint{point("Hello", 100), point("Hi", 20)},
+	}}})
+}
+
+// case3 is the delta histogram the histogram selector produced.
+func case3() []*metricpb.ResourceMetrics {
+	point := func(method string, v float64) *metricpb.HistogramDataPoint {
+		return &metricpb.HistogramDataPoint{
+			Attributes:        methodAttrs(method),
+			StartTimeUnixNano: caseStart,
+			TimeUnixNano:      caseEnd,
+			Count:             1,
+			Sum:               v,
+			ExplicitBounds:    []float64{5000, 10000},
+			BucketCounts:      []uint64{1, 0, 0},
+		}
+	}
+	return casePayload(&metricpb.Metric{Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+		AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		DataPoints:             []*metricpb.HistogramDataPoint{point("Hello", 100), point("Hi", 20)},
+	}}})
+}
+
+func TestDocumentedCases(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload []*metricpb.ResourceMetrics
+		// write selects Validator.Write over Validator.Validate.
+		write bool
+		code  codes.Code
+		msg   string
+	}{
+		{name: "case1", payload: case1(), code: codes.InvalidArgument, msg: case1Error},
+		{name: "case2", payload: case2(), write: true, code: codes.Internal, msg: case2and3Error},
+		{name: "case3", payload: case3(), write: true, code: codes.Internal, msg: case2and3Error},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewValidator(Config{})
+			validate := v.Validate
+			if tc.write {
+				validate = v.Write
+			}
+			st := status.Convert(validate(tc.payload))
+			if st.Code() != tc.code {
+				t.Errorf("code: got %s, want %s", st.Code(), tc.code)
+			}
+			if st.Message() != tc.msg {
+				t.Errorf("message:\ngot:  %s\nwant: %s", st.Message(), tc.msg)
+			}
+		})
+	}
+}
+
+func TestPointAttributes(t *testing.T) {
+	for name, payload := range map[string][]*metricpb.ResourceMetrics{
+		"case1": case1(),
+		"case2": case2(),
+		"case3": case3(),
+	} {
+		if err := NewValidator(Config{PointAttributes: true}).Write(payload); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	v := NewValidator(Config{PointAttributes: true})
+	if err := v.Validate(case2()); err != nil {
+		t.Fatal(err)
+	}
+	err := v.Validate(case2())
+	gerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %v, want *Error", err)
+	}
+	for i, fe := range gerr.Errors {
+		if fe.Index != i || fe.Reason != ReasonOutOfOrder {
+			t.Errorf("error %d: got %v, want timeSeries[%d] out of order", i, fe, i)
+		}
+	}
+	if len(gerr.Errors) != 2 {
+		t.Errorf("got %d errors, want 2", len(gerr.Errors))
+	}
+}
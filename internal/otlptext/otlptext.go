@@ -0,0 +1,59 @@
+// Package otlptext renders OTLP attribute values, attribute sets and
+// aggregation temporalities as the plain text the other packages print,
+// compare and key by.
+package otlptext
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Value renders v the way the collector's logging exporter does: doubles
+// without exponent, arrays as "[a, b]", maps as "{k: v}" and bytes in hex.
+func Value(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_ArrayValue:
+		parts := make([]string, 0, len(val.ArrayValue.GetValues()))
+		for _, e := range val.ArrayValue.GetValues() {
+			parts = append(parts, Value(e))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *commonpb.AnyValue_KvlistValue:
+		parts := make([]string, 0, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			parts = append(parts, kv.GetKey()+": "+Value(kv.GetValue()))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *commonpb.AnyValue_BytesValue:
+		return fmt.Sprintf("%x", val.BytesValue)
+	}
+	return ""
+}
+
+// Attributes renders attrs sorted by key, e.g. "a=1,b=x".
+func Attributes(attrs []*commonpb.KeyValue) string {
+	parts := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		parts = append(parts, kv.GetKey()+"="+Value(kv.GetValue()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Temporality returns the name of t without its prefix, e.g. "DELTA".
+func Temporality(t metricpb.AggregationTemporality) string {
+	return strings.TrimPrefix(t.String(), "AGGREGATION_TEMPORALITY_")
+}
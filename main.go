@@ -2,54 +2,261 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/tyrone-anz/export-otlp-googlecloud/cardinality"
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"github.com/tyrone-anz/export-otlp-googlecloud/manualclock"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	"github.com/tyrone-anz/export-otlp-googlecloud/printer"
+	"github.com/tyrone-anz/export-otlp-googlecloud/receiver"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/global"
-	sdkmetric "go.opentelemetry.io/otel/sdk/export/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
 	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
 	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
-	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
 )
 
 // This file tests the exporting of metrics (value recorder kind) to collector then collector to google cloud.
 // There are two recorded data for the metric with different attribute value.
 // Regardless of the selector aggregator used, google cloud exporter on the collector throws the `Duplicate Timeseries` error.
+//
+// Run with the "matrix" subcommand to try every selector and export kind
+// combination against the embedded receiver, with "replay" to re-send
+// captured requests, with "print" to render captured requests as the
+// collector's logging exporter would, or with "diff" to compare two
+// captures.
 func main() {
 	ctx := context.Background()
-	host := "localhost:55680"
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(ctx, os.Args[2:]); err != nil {
+				fmt.Printf("error %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	client := otlpmetricgrpc.NewClient(
-		otlpmetricgrpc.WithInsecure(),
-		otlpmetricgrpc.WithEndpoint(host),
-	)
+	var opts options
+	opts.register(flag.CommandLine)
+	flag.Parse()
 
-	exporter, err := otlpmetric.New(ctx, client, otlpmetric.WithMetricExportKindSelector(sdkmetric.DeltaExportKindSelector()))
-	if err != nil {
-		fmt.Println("error %v", err)
+	if err := run(ctx, opts); err != nil {
+		fmt.Printf("error %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	// cont := controller.New(processor.New(selector.NewWithInexpensiveDistribution(), exporter),
-	cont := controller.New(processor.New(selector.NewWithExactDistribution(), exporter),
-		// cont := controller.New(processor.New(selector.NewWithHistogramDistribution(), exporter),
-		controller.WithExporter(exporter),
-		controller.WithCollectPeriod(time.Second*2))
+// subcommands maps the first argument to the command it selects.
+var subcommands = map[string]func(ctx context.Context, args []string) error{
+	"matrix": runMatrix,
+	"replay": runReplay,
+	"print":  runPrint,
+	"diff":   runDiff,
+}
 
-	if err := cont.Start(ctx); err != nil {
-		fmt.Println("error %v", err)
-		os.Exit(1)
+func run(ctx context.Context, opts options) error {
+	aggSelector, err := aggregatorSelector(opts.selector)
+	if err != nil {
+		return err
+	}
+	kindSelector, err := exportKindSelector(opts.exportKind)
+	if err != nil {
+		return err
+	}
+	aggSelector, kindSelector, err = opts.ruleSelectors(aggSelector, kindSelector)
+	if err != nil {
+		return err
+	}
+
+	host := opts.endpoint
+	var recv *receiver.Receiver
+	if opts.local {
+		var recvOpts []receiver.Option
+		if opts.emulateGCM {
+			recvOpts = append(recvOpts, receiver.WithRejector(gcm.NewValidator(opts.gcmConfig()).Write))
+		}
+		recv = receiver.New(recvOpts...)
+		if err := recv.Start(""); err != nil {
+			return err
+		}
+		defer recv.Stop()
+		host = recv.Endpoint()
+		if opts.protocol != "grpc" {
+			if err := recv.StartHTTP(""); err != nil {
+				return err
+			}
+			host = recv.HTTPEndpoint()
+		}
+	}
+
+	self, tel, err := opts.startSelfTelemetry(ctx)
+	if err != nil {
+		return err
+	}
+
+	client, err := opts.baseClient(host)
+	if err != nil {
+		return err
+	}
+	client = tel.Transport(client)
+	if opts.print {
+		// Innermost, so the printout is exactly what is sent.
+		client = printer.NewClient(client, os.Stdout)
+	}
+	if client, err = opts.retryingClient(client, tel); err != nil {
+		return err
+	}
+	client = tel.Delivery(client)
+	if client, err = opts.fanOutClient(client, host, tel); err != nil {
+		return err
+	}
+	if opts.queueDir != "" {
+		queued := otlpclient.NewQueued(client, opts.queueDir,
+			otlpclient.WithMaxQueueBytes(opts.queueMaxBytes),
+			otlpclient.WithDropHandler(func(batch string, err error) {
+				fmt.Printf("dropped queued batch %s: %v\n", batch, err)
+				tel.QueueDropped()
+			}))
+		tel.ObserveQueue(queued.Pending)
+		client = queued
+	}
+	var registry *gcm.Registry
+	if opts.descriptors != "" {
+		if registry, err = gcm.LoadRegistry(opts.descriptors); err != nil {
+			return err
+		}
+		client = gcm.NewDescriptorClient(client, opts.gcmConfig(), registry, func(err error) {
+			fmt.Printf("CreateMetricDescriptor would fail: %v\n", err)
+		})
+	}
+	if opts.batchAge > 0 {
+		client = otlpclient.NewBatching(client,
+			otlpclient.WithBatchSeriesKey(gcm.SeriesKey(opts.gcmConfig())),
+			otlpclient.WithMaxBatchAge(opts.batchAge),
+			otlpclient.WithMaxBatchPoints(opts.batchPoints),
+			otlpclient.WithMaxBatchBytes(opts.batchBytes),
+			otlpclient.WithFlushErrorHandler(func(err error) {
+				fmt.Printf("error %v\n", err)
+			}))
+	}
+	client, err = opts.decorate(client, opts.gcmConfig())
+	if err != nil {
+		return err
+	}
+
+	var clock *manualclock.Clock
+	if opts.deterministic {
+		clock = manualclock.New(deterministicStart)
+		client = manualclock.NewClient(client, clock)
+	}
+
+	exporter, err := otlpmetric.New(ctx, client, otlpmetric.WithMetricExportKindSelector(kindSelector))
+	if err != nil {
+		return err
+	}
+
+	var exp export.Exporter = exporter
+	if opts.cardinality {
+		exp = cardinality.NewExporter(exporter, printCardinality,
+			cardinality.WithConfig(opts.gcmConfig()),
+			cardinality.WithDroppedKeys(opts.droppedLabels()...))
+	}
+
+	proc := processor.New(aggSelector, exp, processor.WithMemory(opts.memory))
+	contOpts := []controller.Option{
+		controller.WithExporter(exp),
+		controller.WithCollectPeriod(opts.collectPeriod),
+	}
+	if res, err := opts.resource(); err != nil {
+		return err
+	} else if res != nil {
+		contOpts = append(contOpts, controller.WithResource(res))
+	}
+	cont := controller.New(proc, contOpts...)
+
+	if clock != nil {
+		cont.SetClock(clock)
+		clock.Mark()
+		record(ctx, cont.MeterProvider().Meter(""))
+		if err := runSteps(ctx, cont, proc, exp, clock, opts.collectPeriod, opts.steps); err != nil {
+			return err
+		}
+	} else {
+		if err := cont.Start(ctx); err != nil {
+			return err
+		}
+
+		global.SetMeterProvider(cont.MeterProvider())
+
+		record(ctx, global.Meter(""))
+
+		waitForShutdown(opts.runFor)
+	}
+	shutdown(ctx, cont, exporter, opts.shutdownTimeout)
+	self.shutdown(ctx, opts.shutdownTimeout)
+
+	if registry != nil {
+		if err := registry.Save(opts.descriptors); err != nil {
+			return err
+		}
 	}
 
-	global.SetMeterProvider(cont.MeterProvider())
+	if recv != nil {
+		printRequests(recv.Requests(), clock == nil, opts.gcmConfig(), opts.timeSeries, opts.emulateGCM)
+	}
+	return nil
+}
 
-	meter := global.Meter("")
+// waitForShutdown returns after runFor, or on SIGINT or SIGTERM. A zero
+// runFor waits for a signal only.
+func waitForShutdown(runFor time.Duration) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
 
+	var timeout <-chan time.Time
+	if runFor > 0 {
+		timeout = time.After(runFor)
+	}
+	select {
+	case <-timeout:
+	case sig := <-sigCh:
+		fmt.Printf("received %v, shutting down\n", sig)
+	}
+}
+
+// shutdown stops the controller, which collects and exports one last
+// time, then shuts the exporter down so the client flushes and closes its
+// connection. Both share a context bounded by timeout. The outcome of the
+// final export is printed; a controller that was never started has
+// nothing left to export.
+func shutdown(ctx context.Context, cont *controller.Controller, exporter *otlpmetric.Exporter, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if cont.IsRunning() {
+		if err := cont.Stop(ctx); err != nil {
+			fmt.Printf("final export failed: %v\n", err)
+		} else {
+			fmt.Println("final export succeeded")
+		}
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		fmt.Printf("exporter shutdown failed: %v\n", err)
+	}
+}
+
+// record makes the recordings every case below is based on.
+func record(ctx context.Context, meter metric.Meter) {
 	valuerecorder := metric.Must(meter).NewInt64ValueRecorder("test.dummy.one")
 
 	valuerecorder.Record(ctx, 100, attribute.Any("rpc.method", "Hello"))
@@ -57,8 +264,55 @@ func main() {
 	valuerecorder.Record(ctx, 20, attribute.Any("rpc.method", "Hi"))
 	valuerecorder.Record(ctx, 25, attribute.Any("rpc.method", "Hi"))
 	valuerecorder.Record(ctx, 25, attribute.Any("rpc.method", "Hi"))
+}
 
-	time.Sleep(time.Second * 5) // wait for metrics to be collected
+// printRequests dumps the captured requests in the same JSON form as the
+// collector logs quoted below, followed by the error Cloud Monitoring would
+// return for each of them. The arrival time is left out when withTime is
+// false, so that deterministic runs print identical output. With
+// timeSeries set each request is also shown as the time series the
+// googlecloud exporter would write. With backend set the verdicts follow
+// Validator.Write, matching what -emulate-gcm answered.
+func printRequests(reqs []receiver.Request, withTime bool, cfg gcm.Config, timeSeries, backend bool) {
+	validator := gcm.NewValidator(cfg)
+	validate := validator.Validate
+	if backend {
+		validate = validator.Write
+	}
+	for i, req := range reqs {
+		b, err := marshalJSON(req.Payload)
+		if err != nil {
+			fmt.Printf("error %v\n", err)
+			continue
+		}
+		if withTime {
+			fmt.Printf("Request #%d received at %s\n%s\n", i, req.Received.Format(time.RFC3339Nano), b)
+		} else {
+			fmt.Printf("Request #%d\n%s\n", i, b)
+		}
+		if timeSeries {
+			for j, ts := range gcm.Translate(cfg, req.Payload.GetResourceMetrics()) {
+				fmt.Printf("timeSeries[%d] %s\n", j, ts)
+			}
+		}
+		if err := validate(req.Payload.GetResourceMetrics()); err != nil {
+			fmt.Printf("CreateTimeSeries would fail: %v\n", err)
+		} else {
+			fmt.Println("CreateTimeSeries would succeed")
+		}
+	}
+}
+
+// printCardinality summarises each instrument of a checkpoint set and
+// warns about series that would be written more than once per request.
+func printCardinality(r cardinality.Report) {
+	for _, in := range r.Instruments {
+		fmt.Printf("cardinality: %s (%s): %d label sets, max %d point(s) per label set\n",
+			in.Name, in.Aggregation, len(in.Series), in.MaxPoints())
+	}
+	for _, w := range r.Warnings() {
+		fmt.Printf("warning: %s\n", w)
+	}
 }
 
 // Collector config (v0.31.0)
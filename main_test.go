@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/manualclock"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// captureClient is an otlpmetric.Client that keeps every upload.
+type captureClient struct {
+	mu      sync.Mutex
+	uploads [][]*metricpb.ResourceMetrics
+}
+
+func (c *captureClient) Start(context.Context) error { return nil }
+
+func (c *captureClient) Stop(context.Context) error { return nil }
+
+func (c *captureClient) UploadMetrics(_ context.Context, rms []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploads = append(c.uploads, rms)
+	return nil
+}
+
+// captureCase runs the recordings of main.go through the given selector
+// with delta temporality and one deterministic collection.
+func captureCase(t *testing.T, selector string) []*metricpb.ResourceMetrics {
+	t.Helper()
+	ctx := context.Background()
+
+	aggSelector, err := aggregatorSelector(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture := &captureClient{}
+	clock := manualclock.New(deterministicStart)
+	exporter, err := otlpmetric.New(ctx, manualclock.NewClient(capture, clock),
+		otlpmetric.WithMetricExportKindSelector(export.DeltaExportKindSelector()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := processor.New(aggSelector, exporter)
+	cont := controller.New(proc,
+		controller.WithExporter(exporter),
+		controller.WithResource(deterministicResource()))
+	cont.SetClock(clock)
+	clock.Mark()
+
+	record(ctx, cont.MeterProvider().Meter(""))
+	if err := runSteps(ctx, cont, proc, exporter, clock, 2*time.Second, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(capture.uploads) != 1 {
+		t.Fatalf("got %d uploads, want 1", len(capture.uploads))
+	}
+	return capture.uploads[0]
+}
+
+func TestDocumentedCases(t *testing.T) {
+	for _, tc := range []struct {
+		selector string
+		dataType string
+	}{
+		{selector: "inexpensive", dataType: "Summary"},
+		{selector: "exact", dataType: "Gauge"},
+		{selector: "histogram", dataType: "Histogram"},
+	} {
+		t.Run(tc.selector, func(t *testing.T) {
+			rms := captureCase(t, tc.selector)
+
+			metrics := rms[0].GetInstrumentationLibraryMetrics()[0].GetMetrics()
+			if dataType, _, _ := describeMetric(metrics[0]); dataType != tc.dataType {
+				t.Errorf("data type: got %s, want %s", dataType, tc.dataType)
+			}
+
+			got, err := marshalJSON(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: rms})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", tc.selector+".golden.json")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("payload differs from %s (run with -update to accept):\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestHistogramDefaultBoundaries(t *testing.T) {
+	want := []float64{5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000, 2500000, 5000000, 10000000}
+
+	rms := captureCase(t, "histogram")
+	for _, p := range rms[0].GetInstrumentationLibraryMetrics()[0].GetMetrics()[0].GetHistogram().GetDataPoints() {
+		bounds := p.GetExplicitBounds()
+		if len(bounds) != len(want) {
+			t.Fatalf("got %d bounds, want %d", len(bounds), len(want))
+		}
+		for i := range want {
+			if bounds[i] != want[i] {
+				t.Errorf("bound %d: got %v, want %v", i, bounds[i], want[i])
+			}
+		}
+		if len(p.GetBucketCounts()) != len(want)+1 {
+			t.Errorf("got %d buckets, want %d", len(p.GetBucketCounts()), len(want)+1)
+		}
+	}
+}
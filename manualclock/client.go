@@ -0,0 +1,123 @@
+package manualclock
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type client struct {
+	client otlpmetric.Client
+	clock  *Clock
+}
+
+// NewClient wraps c so that every upload has its timestamps translated
+// onto clock and is put into canonical order. Together with a resource
+// that does not depend on the environment, this makes the payloads of a
+// run identical across runs.
+func NewClient(c otlpmetric.Client, clock *Clock) otlpmetric.Client {
+	return &client{client: c, clock: clock}
+}
+
+// Start starts the wrapped client.
+func (c *client) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *client) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics uploads a translated, canonically ordered copy of
+// protoMetrics.
+func (c *client) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	rms := make([]*metricpb.ResourceMetrics, len(protoMetrics))
+	for i, rm := range protoMetrics {
+		rms[i] = proto.Clone(rm).(*metricpb.ResourceMetrics)
+	}
+	c.translate(rms)
+	Canonicalize(rms)
+	return c.client.UploadMetrics(ctx, rms)
+}
+
+func (c *client) translate(rms []*metricpb.ResourceMetrics) {
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				for _, p := range otlpclient.Points(m) {
+					start, end := otlpclient.Timestamps(p)
+					*start = c.clock.Translate(*start)
+					*end = c.clock.Translate(*end)
+				}
+			}
+		}
+	}
+}
+
+// Canonicalize sorts rms in place: resources, instrumentation libraries
+// and metrics by their identity, and data points by attributes and then
+// by their encoding. The SDK builds payloads from maps, so their order
+// otherwise varies between runs.
+func Canonicalize(rms []*metricpb.ResourceMetrics) {
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				switch data := m.GetData().(type) {
+				case *metricpb.Metric_Gauge:
+					pts := data.Gauge.DataPoints
+					sortPoints(pts, func(i int) attributed { return pts[i] })
+				case *metricpb.Metric_Sum:
+					pts := data.Sum.DataPoints
+					sortPoints(pts, func(i int) attributed { return pts[i] })
+				case *metricpb.Metric_Histogram:
+					pts := data.Histogram.DataPoints
+					sortPoints(pts, func(i int) attributed { return pts[i] })
+				case *metricpb.Metric_Summary:
+					pts := data.Summary.DataPoints
+					sortPoints(pts, func(i int) attributed { return pts[i] })
+				}
+			}
+			sort.SliceStable(ilm.Metrics, func(i, j int) bool {
+				return ilm.Metrics[i].GetName() < ilm.Metrics[j].GetName()
+			})
+		}
+		sort.SliceStable(rm.InstrumentationLibraryMetrics, func(i, j int) bool {
+			return bytes.Compare(encode(rm.InstrumentationLibraryMetrics[i].GetInstrumentationLibrary()),
+				encode(rm.InstrumentationLibraryMetrics[j].GetInstrumentationLibrary())) < 0
+		})
+	}
+	sort.SliceStable(rms, func(i, j int) bool {
+		return bytes.Compare(encode(rms[i].GetResource()), encode(rms[j].GetResource())) < 0
+	})
+}
+
+// attributed is implemented by every OTLP data point type.
+type attributed interface {
+	proto.Message
+	GetAttributes() []*commonpb.KeyValue
+}
+
+// sortPoints orders the data point slice pts, whose elements are read
+// through at, by attributes and then by the full encoding of the point.
+func sortPoints(pts interface{}, at func(i int) attributed) {
+	sort.SliceStable(pts, func(i, j int) bool {
+		pi, pj := at(i), at(j)
+		if ai, aj := otlptext.Attributes(pi.GetAttributes()), otlptext.Attributes(pj.GetAttributes()); ai != aj {
+			return ai < aj
+		}
+		return bytes.Compare(encode(pi), encode(pj)) < 0
+	})
+}
+
+func encode(m proto.Message) []byte {
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	return b
+}
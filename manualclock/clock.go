@@ -0,0 +1,141 @@
+// Package manualclock provides a controller clock that only moves when
+// told to, and the means to make captured payloads follow it.
+package manualclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	controllerTime "go.opentelemetry.io/otel/sdk/metric/controller/time"
+)
+
+// Clock is a controllerTime.Clock whose time is advanced explicitly.
+//
+// The basic processor and the aggregators read the wall clock directly,
+// so Clock also keeps a timeline of marks pairing wall-clock instants
+// with its own time. Translate uses the timeline to move a wall-clock
+// timestamp found in a payload onto the manual clock.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+	marks   []mark
+}
+
+type mark struct {
+	wall   time.Time
+	manual time.Time
+}
+
+var _ controllerTime.Clock = (*Clock)(nil)
+
+// New returns a Clock reading start.
+func New(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now implements controllerTime.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Ticker implements controllerTime.Clock. The ticker fires from Advance.
+func (c *Clock) Ticker(period time.Duration) controllerTime.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &ticker{
+		clock:  c,
+		period: period,
+		next:   c.now.Add(period),
+		ch:     make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d and fires every ticker whose
+// period has elapsed. Like time.Ticker, a ticker drops ticks its reader
+// has not kept up with.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if c.now.Before(t.next) {
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+		for !c.now.Before(t.next) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// Mark records that everything that happened on the wall clock up to
+// now belongs to the current manual time.
+func (c *Clock) Mark() {
+	wall := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marks = append(c.marks, mark{wall: wall, manual: c.now})
+}
+
+// Translate maps a wall-clock timestamp in Unix nanoseconds to the
+// manual time of the first mark made at or after it. Zero stays zero,
+// and timestamps after the last mark map to the current manual time.
+func (c *Clock) Translate(unixNano uint64) uint64 {
+	if unixNano == 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := sort.Search(len(c.marks), func(i int) bool {
+		return uint64(c.marks[i].wall.UnixNano()) >= unixNano
+	})
+	if i == len(c.marks) {
+		return uint64(c.now.UnixNano())
+	}
+	return uint64(c.marks[i].manual.UnixNano())
+}
+
+func (c *Clock) remove(t *ticker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type ticker struct {
+	clock  *Clock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+var _ controllerTime.Ticker = (*ticker)(nil)
+
+// Stop implements controllerTime.Ticker.
+func (t *ticker) Stop() {
+	t.clock.remove(t)
+}
+
+// C implements controllerTime.Ticker.
+func (t *ticker) C() <-chan time.Time {
+	return t.ch
+}
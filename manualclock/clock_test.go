@@ -0,0 +1,119 @@
+package manualclock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+)
+
+var start = time.Date(2021, 8, 26, 3, 20, 55, 0, time.UTC)
+
+// exporter reports the manual time of each export.
+type exporter struct {
+	export.ExportKindSelector
+	clock   *Clock
+	exports chan time.Time
+}
+
+func (e *exporter) Export(context.Context, export.CheckpointSet) error {
+	e.exports <- e.clock.Now()
+	return nil
+}
+
+func TestAdvanceCollects(t *testing.T) {
+	ctx := context.Background()
+	clock := New(start)
+	exp := &exporter{
+		ExportKindSelector: export.CumulativeExportKindSelector(),
+		clock:              clock,
+		exports:            make(chan time.Time, 10),
+	}
+	cont := controller.New(
+		processor.New(selector.NewWithInexpensiveDistribution(), exp),
+		controller.WithExporter(exp),
+		controller.WithCollectPeriod(10*time.Second),
+	)
+	cont.SetClock(clock)
+	metric.Must(cont.MeterProvider().Meter("test")).NewInt64Counter("test.counter").Add(ctx, 1)
+	if err := cont.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want time.Time) {
+		t.Helper()
+		select {
+		case got := <-exp.exports:
+			if !got.Equal(want) {
+				t.Errorf("exported at %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no export at %v", want)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case got := <-exp.exports:
+			t.Errorf("unexpected export at %v", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	clock.Advance(5 * time.Second)
+	expectNone()
+	clock.Advance(5 * time.Second)
+	expect(start.Add(10 * time.Second))
+	// Ticks the controller missed are dropped, as with time.Ticker.
+	clock.Advance(25 * time.Second)
+	expect(start.Add(35 * time.Second))
+	expectNone()
+	clock.Advance(5 * time.Second)
+	expect(start.Add(40 * time.Second))
+
+	if err := cont.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Stop collects once more, and the ticker is gone.
+	expect(start.Add(40 * time.Second))
+	clock.Advance(time.Minute)
+	expectNone()
+}
+
+func TestTranslate(t *testing.T) {
+	clock := New(start)
+	before := uint64(time.Now().UnixNano())
+	clock.Advance(10 * time.Second)
+	clock.Mark()
+	between := uint64(time.Now().UnixNano())
+	// Wall-clock instants must differ for the marks to tell them apart.
+	time.Sleep(time.Millisecond)
+	clock.Advance(10 * time.Second)
+	clock.Mark()
+	clock.Advance(10 * time.Second)
+	after := uint64(time.Now().UnixNano()) + 1
+
+	for _, tc := range []struct {
+		name string
+		wall uint64
+		want time.Time
+	}{
+		{name: "zero", wall: 0},
+		{name: "before the first mark", wall: before, want: start.Add(10 * time.Second)},
+		{name: "between the marks", wall: between, want: start.Add(20 * time.Second)},
+		{name: "after the last mark", wall: after, want: start.Add(30 * time.Second)},
+	} {
+		want := uint64(0)
+		if !tc.want.IsZero() {
+			want = uint64(tc.want.UnixNano())
+		}
+		if got := clock.Translate(tc.wall); got != want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	"github.com/tyrone-anz/export-otlp-googlecloud/receiver"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var (
+	matrixSelectors   = []string{"inexpensive", "exact", "histogram"}
+	matrixExportKinds = []string{"cumulative", "delta", "stateless"}
+)
+
+// matrixResult summarises the payload captured for one combination.
+type matrixResult struct {
+	selector    string
+	exportKind  string
+	dataType    string
+	temporality string
+	maxPoints   int
+	// series and rejected are totals over every request.
+	series   int
+	rejected []gcm.FieldError
+	err      error
+}
+
+// runMatrix runs every selector against every export kind through the
+// embedded receiver and prints one table row per combination.
+func runMatrix(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	prefix := fs.String("prefix", gcm.DefaultPrefix, "Cloud Monitoring metric type prefix")
+	var copts clientOptions
+	copts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var results []matrixResult
+	for _, sel := range matrixSelectors {
+		for _, kind := range matrixExportKinds {
+			res, err := runCombination(ctx, sel, kind, copts, gcm.Config{Prefix: *prefix})
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", sel, kind, err)
+			}
+			results = append(results, res)
+		}
+	}
+	printMatrix(os.Stdout, results)
+	return nil
+}
+
+func runCombination(ctx context.Context, sel, kind string, copts clientOptions, cfg gcm.Config) (matrixResult, error) {
+	res := matrixResult{selector: sel, exportKind: kind}
+
+	aggSelector, err := aggregatorSelector(sel)
+	if err != nil {
+		return res, err
+	}
+	kindSelector, err := exportKindSelector(kind)
+	if err != nil {
+		return res, err
+	}
+
+	recv := receiver.New()
+	if err := recv.Start(""); err != nil {
+		return res, err
+	}
+	defer recv.Stop()
+
+	client, err := copts.decorate(otlpmetricgrpc.NewClient(
+		otlpmetricgrpc.WithInsecure(),
+		otlpmetricgrpc.WithEndpoint(recv.Endpoint()),
+	), cfg)
+	if err != nil {
+		return res, err
+	}
+	exporter, err := otlpmetric.New(ctx, client, otlpmetric.WithMetricExportKindSelector(kindSelector))
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = exporter.Shutdown(ctx) }()
+
+	cont := controller.New(processor.New(aggSelector, exporter), controller.WithExporter(exporter))
+	if err := cont.Start(ctx); err != nil {
+		return res, err
+	}
+	record(ctx, cont.MeterProvider().Meter(""))
+	// Stop performs the final collection and export.
+	if err := cont.Stop(ctx); err != nil {
+		return res, err
+	}
+
+	validator := gcm.NewValidator(cfg)
+	for _, req := range recv.Requests() {
+		rms := req.Payload.GetResourceMetrics()
+		summarise(&res, rms)
+		res.series += len(gcm.SeriesFor(cfg, rms))
+		err := validator.Validate(rms)
+		var gerr *gcm.Error
+		switch {
+		case errors.As(err, &gerr):
+			res.rejected = append(res.rejected, gerr.Errors...)
+		case err != nil && res.err == nil:
+			res.err = err
+		}
+	}
+	return res, nil
+}
+
+// summarise records the data type, temporality and the largest number of
+// points any single series has within one request.
+func summarise(res *matrixResult, rms []*metricpb.ResourceMetrics) {
+	points := make(map[string]int)
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				dataType, temporality, attrs := describeMetric(m)
+				res.dataType, res.temporality = dataType, temporality
+				for _, a := range attrs {
+					points[m.GetName()+"{"+otlptext.Attributes(a)+"}"]++
+				}
+			}
+		}
+	}
+	for _, n := range points {
+		if n > res.maxPoints {
+			res.maxPoints = n
+		}
+	}
+}
+
+// describeMetric returns the OTLP data type, aggregation temporality and
+// the attributes of every point of m.
+func describeMetric(m *metricpb.Metric) (string, string, [][]*commonpb.KeyValue) {
+	var attrs [][]*commonpb.KeyValue
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			attrs = append(attrs, p.GetAttributes())
+		}
+		return "Gauge", "-", attrs
+	case *metricpb.Metric_Sum:
+		for _, p := range data.Sum.GetDataPoints() {
+			attrs = append(attrs, p.GetAttributes())
+		}
+		return "Sum", otlptext.Temporality(data.Sum.GetAggregationTemporality()), attrs
+	case *metricpb.Metric_Histogram:
+		for _, p := range data.Histogram.GetDataPoints() {
+			attrs = append(attrs, p.GetAttributes())
+		}
+		return "Histogram", otlptext.Temporality(data.Histogram.GetAggregationTemporality()), attrs
+	case *metricpb.Metric_Summary:
+		for _, p := range data.Summary.GetDataPoints() {
+			attrs = append(attrs, p.GetAttributes())
+		}
+		return "Summary", "-", attrs
+	}
+	return "None", "-", nil
+}
+
+func printMatrix(w io.Writer, results []matrixResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SELECTOR\tEXPORT KIND\tDATA TYPE\tTEMPORALITY\tPOINTS/SERIES\tRESULT")
+	for _, r := range results {
+		result := "PASS"
+		switch {
+		case len(r.rejected) > 0:
+			result = fmt.Sprintf("FAIL (%d of %d series rejected: %s)", len(r.rejected), r.series, rejectReasons(r.rejected))
+		case r.err != nil:
+			result = "FAIL: " + r.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", r.selector, r.exportKind, r.dataType, r.temporality, r.maxPoints, result)
+	}
+	_ = tw.Flush()
+}
+
+var shortReasons = map[string]string{
+	gcm.ReasonDuplicate:     "duplicate",
+	gcm.ReasonMissingStart:  "missing start time",
+	gcm.ReasonStartAfterEnd: "start after end",
+	gcm.ReasonOutOfOrder:    "out of order",
+}
+
+// rejectReasons lists the distinct reasons of errs in a compact form.
+func rejectReasons(errs []gcm.FieldError) string {
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, fe := range errs {
+		r, ok := shortReasons[fe.Reason]
+		if !ok {
+			r = fe.Reason
+		}
+		if !seen[r] {
+			seen[r] = true
+			reasons = append(reasons, r)
+		}
+	}
+	return strings.Join(reasons, ", ")
+}
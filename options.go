@@ -0,0 +1,386 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/capture"
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlphttp"
+	"github.com/tyrone-anz/export-otlp-googlecloud/rules"
+	"github.com/tyrone-anz/export-otlp-googlecloud/telemetry"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// options holds the command-line configuration of a single run.
+type options struct {
+	selector        string
+	exportKind      string
+	collectPeriod   time.Duration
+	endpoint        string
+	protocol        string
+	compression     string
+	insecure        bool
+	runFor          time.Duration
+	shutdownTimeout time.Duration
+	local           bool
+	rules           string
+	memory          bool
+	deterministic   bool
+	steps           int
+	print           bool
+	metricPrefix    string
+	timeSeries      bool
+	descriptors     string
+	resourceName    string
+	cardinality     bool
+	dropLabels      string
+
+	batchAge      time.Duration
+	batchPoints   int
+	batchBytes    int
+	queueDir      string
+	queueMaxBytes int64
+
+	fanOut        string
+	fanOutPolicy  string
+	fanOutTimeout time.Duration
+
+	retryClassifier string
+	rejectAction    string
+	emulateGCM      bool
+
+	selfTelemetry bool
+	selfEndpoint  string
+
+	capture         string
+	captureFormat   string
+	captureMaxBytes int64
+
+	clientOptions
+}
+
+// clientOptions selects the otlpclient decorators wrapped around the
+// gRPC client.
+type clientOptions struct {
+	split bool
+	dedup string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.selector, "selector", "exact", "aggregator selector: inexpensive, exact or histogram")
+	fs.StringVar(&o.exportKind, "export-kind", "delta", "export kind selector: delta, cumulative or stateless")
+	fs.DurationVar(&o.collectPeriod, "collect-period", 2*time.Second, "controller collect period")
+	fs.StringVar(&o.endpoint, "endpoint", "localhost:55680", "OTLP collector endpoint; the collector's OTLP/HTTP receiver listens on localhost:55681 by default")
+	fs.StringVar(&o.protocol, "protocol", "grpc", "OTLP transport: grpc, http/protobuf or http/json")
+	fs.StringVar(&o.compression, "compression", "", "request compression: gzip, or empty for none")
+	fs.BoolVar(&o.insecure, "insecure", true, "disable client transport security")
+	fs.DurationVar(&o.runFor, "run-for", 5*time.Second, "how long to keep the controller running before exiting; 0 runs until SIGINT or SIGTERM")
+	fs.DurationVar(&o.shutdownTimeout, "shutdown-timeout", 10*time.Second, "bound on the final export and exporter shutdown")
+	fs.BoolVar(&o.local, "local", false, "export to an embedded OTLP receiver instead of -endpoint")
+	fs.StringVar(&o.rules, "rules", "", "JSON file with per-instrument rules; -selector and -export-kind are the fallbacks")
+	fs.BoolVar(&o.memory, "memory", false, "keep processor memory so idle series are still exported")
+	fs.BoolVar(&o.deterministic, "deterministic", false, "drive the controller with a manual clock so payloads are identical across runs")
+	fs.IntVar(&o.steps, "steps", 2, "number of collect periods to advance the manual clock by in -deterministic mode")
+	fs.BoolVar(&o.print, "print", false, "print every upload in the collector logging exporter layout")
+	fs.StringVar(&o.metricPrefix, "metric-prefix", gcm.DefaultPrefix, "Cloud Monitoring metric type prefix, like the googlecloud exporter's metric.prefix")
+	fs.BoolVar(&o.timeSeries, "timeseries", false, "with -local, also print each request as Cloud Monitoring time series")
+	fs.StringVar(&o.descriptors, "descriptors", "", "JSON metric descriptor registry to create descriptors in and check uploads against; kept across runs")
+	fs.StringVar(&o.resourceName, "resource", "", "attach representative resource attributes: gce_instance, k8s_container, generic_task or generic_node")
+	fs.BoolVar(&o.cardinality, "cardinality", false, "report label sets and points per instrument before each export")
+	fs.StringVar(&o.dropLabels, "dropped-labels", "", "comma-separated label keys the backend drops, for -cardinality collision checks")
+	fs.DurationVar(&o.batchAge, "batch-age", 0, "coalesce uploads for up to this long before sending, as few requests as keep each Cloud Monitoring series to one point per request; 0 disables batching")
+	fs.IntVar(&o.batchPoints, "batch-points", 0, "with -batch-age, flush once this many points are batched")
+	fs.IntVar(&o.batchBytes, "batch-bytes", 0, "with -batch-age, flush once the batched points take this many bytes")
+	fs.StringVar(&o.queueDir, "queue-dir", "", "queue uploads in this directory and deliver them in the background, surviving restarts")
+	fs.Int64Var(&o.queueMaxBytes, "queue-max-bytes", 0, "drop the oldest queued uploads beyond this size; 0 is unbounded")
+	fs.StringVar(&o.fanOut, "fanout", "", "comma-separated extra endpoints that receive every upload alongside -endpoint")
+	fs.StringVar(&o.fanOutPolicy, "fanout-policy", "all", "with -fanout, when an upload succeeds: all, any or best-effort")
+	fs.DurationVar(&o.fanOutTimeout, "fanout-timeout", 0, "with -fanout, bound on each destination's upload; 0 uses the exporter's deadline")
+	fs.StringVar(&o.retryClassifier, "retry-classifier", "", "retry -endpoint uploads with a classifier instead of the client's own retries: default or gcm")
+	fs.StringVar(&o.rejectAction, "reject-action", "drop", "with -retry-classifier, what to do with points a partially failed request rejected: drop, or resend duplicated series a millisecond later in separate requests and drop the rest")
+	fs.BoolVar(&o.emulateGCM, "emulate-gcm", false, "with -local, reject requests with the errors Cloud Monitoring would return")
+	fs.BoolVar(&o.selfTelemetry, "self-telemetry", false, "record metrics about the harness's own uploads and print a summary at shutdown")
+	fs.StringVar(&o.selfEndpoint, "self-endpoint", "", "also push the -self-telemetry metrics over OTLP/gRPC to this endpoint; implies -self-telemetry")
+	fs.StringVar(&o.capture, "capture", "", "write uploads to this file instead of sending them to -endpoint")
+	fs.StringVar(&o.captureFormat, "capture-format", "jsonl", "capture file format: jsonl or delimited")
+	fs.Int64Var(&o.captureMaxBytes, "capture-max-bytes", 0, "rotate the capture file at this size; 0 disables rotation")
+	o.clientOptions.register(fs)
+}
+
+func (o *clientOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.split, "split", false, "split uploads so each Cloud Monitoring series appears at most once per request, moving repeated points a millisecond apart")
+	fs.StringVar(&o.dedup, "dedup", "", "collapse repeated series with a reducer: last, sum, max, summary or histogram")
+}
+
+// decorate wraps client with the selected decorators. Deduplication runs
+// before splitting, so splitting only sees what deduplication left.
+// Splitting separates the points cfg maps onto the same time series.
+func (o clientOptions) decorate(client otlpmetric.Client, cfg gcm.Config) (otlpmetric.Client, error) {
+	if o.split {
+		client = otlpclient.NewSplitting(client, otlpclient.WithSeriesKey(gcm.SeriesKey(cfg)))
+	}
+	if o.dedup != "" {
+		r, err := reducer(o.dedup)
+		if err != nil {
+			return nil, err
+		}
+		client = otlpclient.NewDeduplicating(client,
+			otlpclient.WithReducer(r),
+			otlpclient.WithCollapseHandler(func(n int) {
+				fmt.Printf("collapsed %d repeated points\n", n)
+			}))
+	}
+	return client, nil
+}
+
+func reducer(name string) (otlpclient.Reducer, error) {
+	switch name {
+	case "last":
+		return otlpclient.KeepLast, nil
+	case "sum":
+		return otlpclient.Sum, nil
+	case "max":
+		return otlpclient.Max, nil
+	case "summary":
+		return otlpclient.ToSummary, nil
+	case "histogram":
+		return otlpclient.ToHistogram, nil
+	}
+	return 0, fmt.Errorf("unknown reducer %q", name)
+}
+
+// droppedLabels splits -dropped-labels.
+func (o options) droppedLabels() []string {
+	var keys []string
+	for _, k := range strings.Split(o.dropLabels, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// gcmConfig returns the Cloud Monitoring mapping used to check requests.
+func (o options) gcmConfig() gcm.Config {
+	return gcm.Config{Prefix: o.metricPrefix}
+}
+
+// resource returns the resource to give the controller, or nil to keep
+// the SDK default. Deterministic runs replace the executable-derived
+// service.name; -resource adds representative attributes on top.
+func (o options) resource() (*resource.Resource, error) {
+	var res *resource.Resource
+	if o.deterministic {
+		res = deterministicResource()
+	}
+	if o.resourceName == "" {
+		return res, nil
+	}
+	extra, err := representativeResource(o.resourceName)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = resource.Default()
+	}
+	return resource.Merge(res, extra)
+}
+
+// aggregatorSelector returns the simple selector for one of the three
+// cases documented in main.go.
+func aggregatorSelector(name string) (export.AggregatorSelector, error) {
+	switch name {
+	case "inexpensive":
+		return selector.NewWithInexpensiveDistribution(), nil
+	case "exact":
+		return selector.NewWithExactDistribution(), nil
+	case "histogram":
+		return selector.NewWithHistogramDistribution(), nil
+	}
+	return nil, fmt.Errorf("unknown selector %q", name)
+}
+
+// baseClient returns the client that uploads are finally handed to: a
+// capture file when -capture is set, otherwise the client for -protocol
+// pointed at endpoint.
+func (o options) baseClient(endpoint string) (otlpmetric.Client, error) {
+	if o.capture != "" {
+		format, err := capture.ParseFormat(o.captureFormat)
+		if err != nil {
+			return nil, err
+		}
+		return capture.NewClient(o.capture, capture.WithFormat(format), capture.WithMaxBytes(o.captureMaxBytes)), nil
+	}
+	return o.transportClient(endpoint)
+}
+
+// transportClient returns the client for -protocol pointed at endpoint.
+func (o options) transportClient(endpoint string) (otlpmetric.Client, error) {
+	if o.compression != "" && o.compression != "gzip" {
+		return nil, fmt.Errorf("unknown compression %q", o.compression)
+	}
+
+	switch o.protocol {
+	case "grpc":
+		clientOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+		if o.insecure {
+			clientOpts = append(clientOpts, otlpmetricgrpc.WithInsecure())
+		}
+		if o.compression != "" {
+			clientOpts = append(clientOpts, otlpmetricgrpc.WithCompressor(o.compression))
+		}
+		if o.retryClassifier != "" {
+			clientOpts = append(clientOpts, otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetrySettings{Enabled: false}))
+		}
+		return otlpmetricgrpc.NewClient(clientOpts...), nil
+	case "http/protobuf", "http/json":
+		clientOpts := []otlphttp.Option{otlphttp.WithEndpoint(endpoint)}
+		if o.insecure {
+			clientOpts = append(clientOpts, otlphttp.WithInsecure())
+		}
+		if o.compression == "gzip" {
+			clientOpts = append(clientOpts, otlphttp.WithCompression(otlphttp.GzipCompression))
+		}
+		if o.protocol == "http/json" {
+			clientOpts = append(clientOpts, otlphttp.WithEncoding(otlphttp.JSONEncoding))
+		}
+		if o.retryClassifier != "" {
+			clientOpts = append(clientOpts, otlphttp.WithRetry(otlphttp.RetrySettings{Enabled: false}))
+		}
+		return otlphttp.NewClient(clientOpts...), nil
+	}
+	return nil, fmt.Errorf("unknown protocol %q", o.protocol)
+}
+
+// retryingClient wraps client with the -retry-classifier retry loop,
+// reporting retries and rejected points to tel. It returns client
+// unchanged when -retry-classifier is empty, leaving retries to the
+// transport.
+func (o options) retryingClient(client otlpmetric.Client, tel *telemetry.Metrics) (otlpmetric.Client, error) {
+	if o.retryClassifier == "" {
+		return client, nil
+	}
+	classify, err := retryClassifier(o.retryClassifier)
+	if err != nil {
+		return nil, err
+	}
+	if o.rejectAction != "drop" && o.rejectAction != "resend" {
+		return nil, fmt.Errorf("unknown reject action %q", o.rejectAction)
+	}
+	return otlpclient.NewRetrying(client,
+		otlpclient.WithRetryClassifier(classify),
+		otlpclient.WithRetryHandler(tel.Retried),
+		otlpclient.WithResendSplit(otlpclient.WithSeriesKey(gcm.SeriesKey(o.gcmConfig()))),
+		otlpclient.WithRejectHandler(func(r otlpclient.Rejection) otlpclient.RejectAction {
+			// Only a duplicate can succeed once it has a request of its own.
+			if o.rejectAction == "resend" && strings.Contains(r.Reason, gcm.ReasonDuplicate) {
+				fmt.Printf("resending rejected point: %s\n", r.Reason)
+				tel.Rejected(1, "resend")
+				return otlpclient.Resend
+			}
+			fmt.Printf("dropping rejected point: %s\n", r.Reason)
+			tel.Rejected(1, "drop")
+			return otlpclient.Drop
+		})), nil
+}
+
+func retryClassifier(name string) (otlpclient.RetryClassifier, error) {
+	switch name {
+	case "default":
+		return otlpclient.DefaultClassifier, nil
+	case "gcm":
+		return gcm.Classify, nil
+	}
+	return nil, fmt.Errorf("unknown retry classifier %q", name)
+}
+
+// fanOutClient sends every upload to client, named name, and to each
+// -fanout endpoint, combining the outcomes with -fanout-policy. Each
+// endpoint retries on its own, like client, rather than through the
+// fan-out, which would send the upload again to every destination. It
+// returns client unchanged when -fanout is empty.
+func (o options) fanOutClient(client otlpmetric.Client, name string, tel *telemetry.Metrics) (otlpmetric.Client, error) {
+	if o.fanOut == "" {
+		return client, nil
+	}
+	policy, err := fanOutPolicy(o.fanOutPolicy)
+	if err != nil {
+		return nil, err
+	}
+	dests := []otlpclient.Destination{{Name: name, Client: client, Timeout: o.fanOutTimeout}}
+	for _, endpoint := range strings.Split(o.fanOut, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		c, err := o.transportClient(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = o.retryingClient(c, tel); err != nil {
+			return nil, err
+		}
+		dests = append(dests, otlpclient.Destination{Name: endpoint, Client: c, Timeout: o.fanOutTimeout})
+	}
+	return otlpclient.NewFanOut(dests,
+		otlpclient.WithPolicy(policy),
+		otlpclient.WithDestinationErrorHandler(func(err otlpclient.DestinationError) {
+			fmt.Printf("destination %v\n", err)
+		})), nil
+}
+
+func fanOutPolicy(name string) (otlpclient.FanOutPolicy, error) {
+	switch name {
+	case "all":
+		return otlpclient.AllMustSucceed, nil
+	case "any":
+		return otlpclient.AnyMustSucceed, nil
+	case "best-effort":
+		return otlpclient.BestEffort, nil
+	}
+	return 0, fmt.Errorf("unknown fan-out policy %q", name)
+}
+
+// ruleSelectors loads the rules file, if any, and layers it over the
+// selectors chosen by -selector and -export-kind. Export kind rules are
+// checked against -memory.
+func (o options) ruleSelectors(aggFallback export.AggregatorSelector, kindFallback export.ExportKindSelector) (export.AggregatorSelector, export.ExportKindSelector, error) {
+	if o.rules == "" {
+		return aggFallback, kindFallback, nil
+	}
+	rf, err := rules.Load(o.rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	aggSelector, err := rules.NewAggregatorSelector(rf.Aggregators, aggFallback)
+	if err != nil {
+		return nil, nil, err
+	}
+	kindSelector, err := rules.NewExportKindSelector(rf.ExportKinds, kindFallback)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := kindSelector.CheckMemory(o.memory); err != nil {
+		return nil, nil, err
+	}
+	return aggSelector, kindSelector, nil
+}
+
+func exportKindSelector(name string) (export.ExportKindSelector, error) {
+	switch name {
+	case "delta":
+		return export.DeltaExportKindSelector(), nil
+	case "cumulative":
+		return export.CumulativeExportKindSelector(), nil
+	case "stateless":
+		return export.StatelessExportKindSelector(), nil
+	}
+	return nil, fmt.Errorf("unknown export kind %q", name)
+}
@@ -0,0 +1,313 @@
+package otlpclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultBatchMaxAge = 10 * time.Second
+
+// BatchOption configures a client returned by NewBatching.
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	key       SeriesKeyFunc
+	maxPoints int
+	maxBytes  int
+	maxAge    time.Duration
+	onError   func(error)
+}
+
+// WithBatchSeriesKey sets how the series of a point is identified, as
+// WithSeriesKey does for Split. Below a splitting client it should be the
+// same function, or batching may merge back points the split separated.
+func WithBatchSeriesKey(fn SeriesKeyFunc) BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.key = fn
+	}
+}
+
+// WithMaxBatchPoints flushes once n points are batched. Zero, the default,
+// sets no limit.
+func WithMaxBatchPoints(n int) BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.maxPoints = n
+	}
+}
+
+// WithMaxBatchBytes flushes once the encoded points batched take n bytes.
+// Zero, the default, sets no limit.
+func WithMaxBatchBytes(n int) BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.maxBytes = n
+	}
+}
+
+// WithMaxBatchAge flushes d after the first point was batched. The default
+// is 10s.
+func WithMaxBatchAge(d time.Duration) BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.maxAge = d
+	}
+}
+
+// WithFlushErrorHandler receives the error of every batch that failed to
+// upload, as a *FlushError, except for the final flush on Stop, whose
+// error Stop returns. By default errors go to otel.Handle.
+func WithFlushErrorHandler(fn func(error)) BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.onError = fn
+	}
+}
+
+// FlushError reports a batch the wrapped client failed to upload. The
+// points of the batch are dropped; the batching client does not retry.
+type FlushError struct {
+	// Points is the number of points lost.
+	Points int
+	Err    error
+}
+
+func (e *FlushError) Error() string {
+	return fmt.Sprintf("otlpclient: batch of %d points dropped: %v", e.Points, e.Err)
+}
+
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+type batchingClient struct {
+	client otlpmetric.Client
+	cfg    batchConfig
+
+	// sendMu serialises uploads so that batches go out in the order they
+	// were cut. It is never acquired while mu is held.
+	sendMu sync.Mutex
+
+	mu sync.Mutex
+	// slots are the requests of the next flush: the n-th holds the n-th
+	// point batched of each series.
+	slots  []*batch
+	points int
+	bytes  int
+	// gen counts flushes, so that a timer can tell whether its flush
+	// already happened.
+	gen    int
+	full   []*batch
+	timer  *time.Timer
+	closed bool
+}
+
+// NewBatching wraps client so that the uploads of several collection
+// intervals are coalesced. Points are merged by resource, instrumentation
+// library and metric, and flushed when the point or byte limit or the
+// maximum age is reached, and on Stop.
+//
+// No request carries two points of the same series: a flush is sent as
+// the smallest number of requests that allows, the n-th holding the n-th
+// point of each series, so every series keeps its order. Successive
+// collections of the same series thus still need one request each, but
+// points of other series share them, however many intervals apart they
+// were collected.
+//
+// UploadMetrics returns once protoMetrics is batched, after uploading any
+// flush it caused. A request that fails to upload is dropped and reported
+// to the flush error handler rather than to the caller, whose own points
+// may still be waiting for the next flush.
+func NewBatching(client otlpmetric.Client, opts ...BatchOption) otlpmetric.Client {
+	c := &batchingClient{
+		client: client,
+		cfg:    batchConfig{maxAge: defaultBatchMaxAge, onError: otel.Handle},
+	}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start starts the wrapped client.
+func (c *batchingClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = false
+	c.mu.Unlock()
+	return c.client.Start(ctx)
+}
+
+// Stop flushes the batched points and stops the wrapped client.
+func (c *batchingClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	c.cutLocked()
+	c.closed = true
+	c.mu.Unlock()
+
+	var errs []string
+	c.send(ctx, func(err error) {
+		errs = append(errs, err.Error())
+	})
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("batch flush failed: %s", strings.Join(errs, "; "))
+	}
+	if serr := c.client.Stop(ctx); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// UploadMetrics adds each point of protoMetrics to the first request of
+// the next flush that lacks its series, flushing whenever a limit is
+// reached, and uploads the requests it flushed.
+func (c *batchingClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.client.UploadMetrics(ctx, protoMetrics)
+	}
+	gen := c.gen
+	walk(protoMetrics, func(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+		key := pointKey(c.cfg.key, rm, ilm, m, p)
+		if c.points == 0 && c.cfg.maxAge > 0 {
+			c.startTimer()
+		}
+		n := 0
+		for n < len(c.slots) && c.slots[n].series[key] {
+			n++
+		}
+		if n == len(c.slots) {
+			c.slots = append(c.slots, newBatch())
+		}
+		c.slots[n].add(key, rm, ilm, m, p)
+		c.points++
+		c.bytes += proto.Size(p)
+		if (c.cfg.maxPoints > 0 && c.points >= c.cfg.maxPoints) ||
+			(c.cfg.maxBytes > 0 && c.bytes >= c.cfg.maxBytes) {
+			c.cutLocked()
+		}
+	})
+	// A flush made by another call is sent by that call.
+	cut := c.gen != gen
+	c.mu.Unlock()
+
+	if cut {
+		c.send(ctx, c.report)
+	}
+	return nil
+}
+
+func (c *batchingClient) report(err error) {
+	if c.cfg.onError != nil {
+		c.cfg.onError(err)
+	}
+}
+
+func (c *batchingClient) startTimer() {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	gen := c.gen
+	c.timer = time.AfterFunc(c.cfg.maxAge, func() {
+		c.mu.Lock()
+		// The points may already have been flushed for another reason.
+		if c.gen != gen {
+			c.mu.Unlock()
+			return
+		}
+		c.cutLocked()
+		c.mu.Unlock()
+
+		c.send(context.Background(), c.report)
+	})
+}
+
+// cutLocked queues the requests of the next flush, if any, for upload.
+func (c *batchingClient) cutLocked() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.points == 0 {
+		return
+	}
+	c.full = append(c.full, c.slots...)
+	c.slots, c.points, c.bytes = nil, 0, 0
+	c.gen++
+}
+
+// send uploads the queued requests oldest first, passing a *FlushError to
+// fail for each one that the wrapped client rejects.
+func (c *batchingClient) send(ctx context.Context, fail func(error)) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	for {
+		c.mu.Lock()
+		if len(c.full) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		b := c.full[0]
+		c.full = c.full[1:]
+		c.mu.Unlock()
+
+		if err := c.client.UploadMetrics(ctx, b.rms); err != nil {
+			fail(&FlushError{Points: b.points, Err: err})
+		}
+	}
+}
+
+// batch accumulates one request from several uploads, merging the
+// enclosing messages by value rather than by identity.
+type batch struct {
+	rms    []*metricpb.ResourceMetrics
+	rm     map[string]*metricpb.ResourceMetrics
+	ilm    map[string]*metricpb.InstrumentationLibraryMetrics
+	m      map[string]*metricpb.Metric
+	series map[string]bool
+	points int
+}
+
+func newBatch() *batch {
+	return &batch{
+		rm:     make(map[string]*metricpb.ResourceMetrics),
+		ilm:    make(map[string]*metricpb.InstrumentationLibraryMetrics),
+		m:      make(map[string]*metricpb.Metric),
+		series: make(map[string]bool),
+	}
+}
+
+func (b *batch) add(key string, rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+	resKey := scopeKey(rm.GetResource(), nil)
+	dstRM, ok := b.rm[resKey]
+	if !ok {
+		dstRM = &metricpb.ResourceMetrics{Resource: rm.GetResource()}
+		b.rm[resKey] = dstRM
+		b.rms = append(b.rms, dstRM)
+	}
+	libKey := scopeKey(rm.GetResource(), ilm.GetInstrumentationLibrary())
+	dstILM, ok := b.ilm[libKey]
+	if !ok {
+		dstILM = &metricpb.InstrumentationLibraryMetrics{InstrumentationLibrary: ilm.GetInstrumentationLibrary()}
+		b.ilm[libKey] = dstILM
+		dstRM.InstrumentationLibraryMetrics = append(dstRM.InstrumentationLibraryMetrics, dstILM)
+	}
+	shell := emptyMetric(m)
+	enc, _ := proto.MarshalOptions{Deterministic: true}.Marshal(shell)
+	metricKey := libKey + "/" + string(enc)
+	dstM, ok := b.m[metricKey]
+	if !ok {
+		dstM = shell
+		b.m[metricKey] = dstM
+		dstILM.Metrics = append(dstILM.Metrics, dstM)
+	}
+	appendPoint(dstM, p)
+	b.series[key] = true
+	b.points++
+}
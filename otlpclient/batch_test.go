@@ -0,0 +1,158 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchReportsDroppedFlush(t *testing.T) {
+	ctx := context.Background()
+	var flushErrs []error
+	client := &fakeClient{uploadErrs: []error{status.Error(codes.Unavailable, "down")}}
+	c := NewBatching(client,
+		WithMaxBatchAge(time.Hour),
+		WithMaxBatchPoints(3),
+		WithFlushErrorHandler(func(err error) { flushErrs = append(flushErrs, err) }))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "a"} {
+		// The third point flushes two requests, {a, b} and {a}. The
+		// first fails, which is not the caller's failure.
+		if err := c.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatalf("upload %s: %v", name, err)
+		}
+	}
+	if len(flushErrs) != 1 {
+		t.Fatalf("got %d flush errors, want 1", len(flushErrs))
+	}
+	var fe *FlushError
+	if !errors.As(flushErrs[0], &fe) || fe.Points != 2 || status.Code(fe.Err) != codes.Unavailable {
+		t.Errorf("got %v, want 2 points dropped with Unavailable", flushErrs[0])
+	}
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.names(), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestBatchUploadsOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{block: make(chan struct{})}
+	c := NewBatching(client, WithMaxBatchAge(time.Hour), WithMaxBatchPoints(2))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UploadMetrics(ctx, payload("x")); err != nil {
+		t.Fatal(err)
+	}
+	b := c.(*batchingClient)
+	sent := make(chan error)
+	go func() {
+		// Flushes {x} twice and blocks in the wrapped client.
+		sent <- c.UploadMetrics(ctx, payload("x"))
+	}()
+	eventually(t, "the first request to be sent", func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.gen == 1 && len(b.full) == 1
+	})
+
+	added := make(chan error)
+	go func() {
+		added <- c.UploadMetrics(ctx, payload("y"))
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("UploadMetrics waited for the upload of another batch")
+	}
+
+	close(client.block)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.names(), []string{"x", "x", "y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestBatchCoalescesIntervals(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	c := NewBatching(client, WithMaxBatchAge(time.Hour))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Three collections: "a" every time, "b" and "c" once each.
+	for _, upload := range [][]string{{"a", "b"}, {"a"}, {"a", "c"}} {
+		var rms []*metricpb.ResourceMetrics
+		for _, name := range upload {
+			rms = append(rms, payload(name)...)
+		}
+		if err := c.UploadMetrics(ctx, rms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uploadNames(client), [][]string{{"a", "b", "c"}, {"a"}, {"a"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestBatchSeriesKey(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	// Every point belongs to the same series.
+	c := NewBatching(client, WithMaxBatchAge(time.Hour), WithBatchSeriesKey(func([]*metricpb.ResourceMetrics) string {
+		return "one"
+	}))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := c.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uploadNames(client), [][]string{{"a"}, {"b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+// uploadNames returns the metric names of each upload that succeeded.
+func uploadNames(c *fakeClient) [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out [][]string
+	for _, rms := range c.uploads {
+		var names []string
+		walk(rms, func(_ *metricpb.ResourceMetrics, _ *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, _ DataPoint) {
+			names = append(names, m.GetName())
+		})
+		out = append(out, names)
+	}
+	return out
+}
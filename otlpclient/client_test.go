@@ -0,0 +1,93 @@
+package otlpclient
+
+import (
+	"context"
+	"sync"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// fakeClient is an otlpmetric.Client that records its calls. Uploads
+// fail with the errors of uploadErrs in turn, then with err, which
+// defaults to success; block, when set, holds every upload until it is
+// closed or the context is done.
+type fakeClient struct {
+	startErr   error
+	block      chan struct{}
+	uploadErrs []error
+	err        error
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	calls   int
+	uploads [][]*metricpb.ResourceMetrics
+}
+
+func (c *fakeClient) Start(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = c.startErr == nil
+	return c.startErr
+}
+
+func (c *fakeClient) Stop(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	return nil
+}
+
+func (c *fakeClient) UploadMetrics(ctx context.Context, rms []*metricpb.ResourceMetrics) error {
+	if c.block != nil {
+		select {
+		case <-c.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if len(c.uploadErrs) > 0 {
+		err := c.uploadErrs[0]
+		c.uploadErrs = c.uploadErrs[1:]
+		if err != nil {
+			return err
+		}
+	} else if c.err != nil {
+		return c.err
+	}
+	c.uploads = append(c.uploads, rms)
+	return nil
+}
+
+// names returns the metric name of every upload that succeeded.
+func (c *fakeClient) names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []string
+	for _, rms := range c.uploads {
+		walk(rms, func(_ *metricpb.ResourceMetrics, _ *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, _ DataPoint) {
+			out = append(out, m.GetName())
+		})
+	}
+	return out
+}
+
+// payload returns one gauge point for metric name.
+func payload(name string) []*metricpb.ResourceMetrics {
+	return []*metricpb.ResourceMetrics{{
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricpb.Metric{{
+				Name: name,
+				Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+					DataPoints: []*metricpb.NumberDataPoint{{
+						TimeUnixNano: 1629948057000000000,
+						Value:        &metricpb.NumberDataPoint_AsInt{AsInt: 1},
+					}},
+				}},
+			}},
+		}},
+	}}
+}
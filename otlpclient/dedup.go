@@ -0,0 +1,424 @@
+package otlpclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Reducer selects how the points of a repeated series are collapsed.
+type Reducer int
+
+const (
+	// KeepLast keeps the point with the latest TimeUnixNano.
+	KeepLast Reducer = iota
+	// Sum adds the values together. Histogram points with the same
+	// bounds have their buckets merged; summary points have their counts
+	// and sums added.
+	Sum
+	// Max keeps the largest value. Histogram and summary points are
+	// compared by their sum.
+	Max
+	// ToSummary converts the raw points of a Gauge into one Summary point
+	// with the count, sum, minimum and maximum. Other data types are
+	// reduced with KeepLast.
+	ToSummary
+	// ToHistogram converts the raw points of a Gauge into one Histogram
+	// point. Other data types are reduced with KeepLast.
+	ToHistogram
+)
+
+// defaultFloat64Boundaries and defaultInt64Boundaries match the defaults
+// of the SDK histogram aggregator.
+var (
+	defaultFloat64Boundaries = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	defaultInt64Boundaries   = []float64{5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000, 2500000, 5000000, 10000000}
+)
+
+// DedupOption configures a client returned by NewDeduplicating.
+type DedupOption func(*dedupConfig)
+
+type dedupConfig struct {
+	reducer    Reducer
+	boundaries []float64
+	onCollapse func(n int)
+}
+
+// WithReducer sets the Reducer. The default is KeepLast.
+func WithReducer(r Reducer) DedupOption {
+	return func(cfg *dedupConfig) {
+		cfg.reducer = r
+	}
+}
+
+// WithHistogramBoundaries sets the explicit bounds used by ToHistogram.
+// By default the SDK histogram defaults for the point number type are used.
+func WithHistogramBoundaries(boundaries []float64) DedupOption {
+	return func(cfg *dedupConfig) {
+		cfg.boundaries = boundaries
+	}
+}
+
+// WithCollapseHandler registers fn to be called after every upload in
+// which points were collapsed, with the number of points removed.
+func WithCollapseHandler(fn func(n int)) DedupOption {
+	return func(cfg *dedupConfig) {
+		cfg.onCollapse = fn
+	}
+}
+
+type deduplicatingClient struct {
+	client otlpmetric.Client
+	cfg    dedupConfig
+}
+
+// NewDeduplicating wraps client so that each upload holds at most one
+// point per series.
+func NewDeduplicating(client otlpmetric.Client, opts ...DedupOption) otlpmetric.Client {
+	c := &deduplicatingClient{client: client}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start starts the wrapped client.
+func (c *deduplicatingClient) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *deduplicatingClient) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics collapses repeated series and uploads the result.
+func (c *deduplicatingClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	rms, n := c.deduplicate(protoMetrics)
+	if n > 0 && c.cfg.onCollapse != nil {
+		c.cfg.onCollapse(n)
+	}
+	return c.client.UploadMetrics(ctx, rms)
+}
+
+// series holds the points of one series in payload order.
+type series struct {
+	rm     *metricpb.ResourceMetrics
+	ilm    *metricpb.InstrumentationLibraryMetrics
+	m      *metricpb.Metric
+	points []DataPoint
+}
+
+// deduplicate returns rms with every series reduced to a single point,
+// and the number of points that were removed. The input is not modified.
+func (c *deduplicatingClient) deduplicate(rms []*metricpb.ResourceMetrics) ([]*metricpb.ResourceMetrics, int) {
+	var order []*series
+	byKey := make(map[string]*series)
+	total := 0
+	repeated := false
+	walk(rms, func(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+		total++
+		// Metrics of one name but different data types are kept apart,
+		// so that each reducer only sees points of its type.
+		key := fmt.Sprintf("%T", m.GetData()) + seriesKey(rm, ilm, m, p)
+		s, ok := byKey[key]
+		if !ok {
+			s = &series{rm: rm, ilm: ilm, m: m}
+			byKey[key] = s
+			order = append(order, s)
+		} else {
+			repeated = true
+		}
+		s.points = append(s.points, p)
+	})
+	if !repeated && !c.converts() {
+		return rms, 0
+	}
+
+	b := newBuilder()
+	b.shell = c.shell
+	for _, s := range order {
+		b.add(s.rm, s.ilm, s.m, c.reduce(s.m, s.points))
+	}
+	return b.payload(), total - b.size
+}
+
+func (c *deduplicatingClient) converts() bool {
+	return c.cfg.reducer == ToSummary || c.cfg.reducer == ToHistogram
+}
+
+// shell returns the empty destination metric, converting Gauges when the
+// reducer asks for it.
+func (c *deduplicatingClient) shell(m *metricpb.Metric) *metricpb.Metric {
+	out := emptyMetric(m)
+	if m.GetGauge() == nil {
+		return out
+	}
+	switch c.cfg.reducer {
+	case ToSummary:
+		out.Data = &metricpb.Metric_Summary{Summary: &metricpb.Summary{}}
+	case ToHistogram:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		}}
+	}
+	return out
+}
+
+func (c *deduplicatingClient) reduce(m *metricpb.Metric, pts []DataPoint) DataPoint {
+	switch m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		switch c.cfg.reducer {
+		case ToSummary:
+			return numbersToSummary(pts)
+		case ToHistogram:
+			return numbersToHistogram(pts, c.cfg.boundaries)
+		}
+		return reduceNumbers(c.cfg.reducer, pts)
+	case *metricpb.Metric_Sum:
+		return reduceNumbers(c.cfg.reducer, pts)
+	case *metricpb.Metric_Histogram:
+		return reduceHistograms(c.cfg.reducer, pts)
+	case *metricpb.Metric_Summary:
+		return reduceSummaries(c.cfg.reducer, pts)
+	}
+	return pts[len(pts)-1]
+}
+
+// latest returns the point with the largest TimeUnixNano, preferring the
+// later one in payload order on ties.
+func latest(pts []DataPoint) DataPoint {
+	last := pts[0]
+	for _, p := range pts[1:] {
+		if p.GetTimeUnixNano() >= last.GetTimeUnixNano() {
+			last = p
+		}
+	}
+	return last
+}
+
+// interval returns the earliest start and latest end time of pts.
+func interval(pts []DataPoint) (uint64, uint64) {
+	start, end := pts[0].GetStartTimeUnixNano(), pts[0].GetTimeUnixNano()
+	for _, p := range pts[1:] {
+		if s := p.GetStartTimeUnixNano(); s < start {
+			start = s
+		}
+		if e := p.GetTimeUnixNano(); e > end {
+			end = e
+		}
+	}
+	return start, end
+}
+
+func numberValue(p *metricpb.NumberDataPoint) float64 {
+	if v, ok := p.GetValue().(*metricpb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return p.GetAsDouble()
+}
+
+func allInts(pts []DataPoint) bool {
+	for _, p := range pts {
+		if _, ok := p.(*metricpb.NumberDataPoint).GetValue().(*metricpb.NumberDataPoint_AsInt); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func reduceNumbers(r Reducer, pts []DataPoint) DataPoint {
+	if len(pts) == 1 {
+		return pts[0]
+	}
+	switch r {
+	case Sum:
+		start, end := interval(pts)
+		first := pts[0].(*metricpb.NumberDataPoint)
+		out := &metricpb.NumberDataPoint{
+			Attributes:        first.GetAttributes(),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+		}
+		if allInts(pts) {
+			var sum int64
+			for _, p := range pts {
+				sum += p.(*metricpb.NumberDataPoint).GetAsInt()
+			}
+			out.Value = &metricpb.NumberDataPoint_AsInt{AsInt: sum}
+		} else {
+			var sum float64
+			for _, p := range pts {
+				sum += numberValue(p.(*metricpb.NumberDataPoint))
+			}
+			out.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: sum}
+		}
+		return out
+	case Max:
+		max := pts[0].(*metricpb.NumberDataPoint)
+		for _, p := range pts[1:] {
+			if np := p.(*metricpb.NumberDataPoint); numberValue(np) > numberValue(max) {
+				max = np
+			}
+		}
+		return max
+	}
+	return latest(pts)
+}
+
+func numbersToSummary(pts []DataPoint) DataPoint {
+	start, end := interval(pts)
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, p := range pts {
+		v := numberValue(p.(*metricpb.NumberDataPoint))
+		sum += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	return &metricpb.SummaryDataPoint{
+		Attributes:        pts[0].GetAttributes(),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Count:             uint64(len(pts)),
+		Sum:               sum,
+		QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{
+			{Quantile: 0, Value: min},
+			{Quantile: 1, Value: max},
+		},
+	}
+}
+
+func numbersToHistogram(pts []DataPoint, boundaries []float64) DataPoint {
+	if boundaries == nil {
+		boundaries = defaultFloat64Boundaries
+		if allInts(pts) {
+			boundaries = defaultInt64Boundaries
+		}
+	}
+	start, end := interval(pts)
+	out := &metricpb.HistogramDataPoint{
+		Attributes:        pts[0].GetAttributes(),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Count:             uint64(len(pts)),
+		BucketCounts:      make([]uint64, len(boundaries)+1),
+		ExplicitBounds:    boundaries,
+	}
+	for _, p := range pts {
+		v := numberValue(p.(*metricpb.NumberDataPoint))
+		out.Sum += v
+		bucket := len(boundaries)
+		for i, b := range boundaries {
+			if v < b {
+				bucket = i
+				break
+			}
+		}
+		out.BucketCounts[bucket]++
+	}
+	return out
+}
+
+func reduceHistograms(r Reducer, pts []DataPoint) DataPoint {
+	if len(pts) == 1 {
+		return pts[0]
+	}
+	switch r {
+	case Sum:
+		first := pts[0].(*metricpb.HistogramDataPoint)
+		start, end := interval(pts)
+		out := &metricpb.HistogramDataPoint{
+			Attributes:        first.GetAttributes(),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+			BucketCounts:      make([]uint64, len(first.GetBucketCounts())),
+			ExplicitBounds:    first.GetExplicitBounds(),
+		}
+		for _, p := range pts {
+			hp := p.(*metricpb.HistogramDataPoint)
+			if !equalBounds(hp.GetExplicitBounds(), out.ExplicitBounds) || len(hp.GetBucketCounts()) != len(out.BucketCounts) {
+				// Buckets cannot be merged; fall back to the newest point.
+				return latest(pts)
+			}
+			out.Count += hp.GetCount()
+			out.Sum += hp.GetSum()
+			for i, n := range hp.GetBucketCounts() {
+				out.BucketCounts[i] += n
+			}
+		}
+		return out
+	case Max:
+		max := pts[0].(*metricpb.HistogramDataPoint)
+		for _, p := range pts[1:] {
+			if hp := p.(*metricpb.HistogramDataPoint); hp.GetSum() > max.GetSum() {
+				max = hp
+			}
+		}
+		return max
+	}
+	return latest(pts)
+}
+
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func reduceSummaries(r Reducer, pts []DataPoint) DataPoint {
+	if len(pts) == 1 {
+		return pts[0]
+	}
+	switch r {
+	case Sum:
+		start, end := interval(pts)
+		last := latest(pts).(*metricpb.SummaryDataPoint)
+		out := &metricpb.SummaryDataPoint{
+			Attributes:        last.GetAttributes(),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+		}
+		// The minimum and maximum can be merged exactly; other
+		// quantiles are taken from the newest point.
+		for _, q := range last.GetQuantileValues() {
+			out.QuantileValues = append(out.QuantileValues, &metricpb.SummaryDataPoint_ValueAtQuantile{
+				Quantile: q.GetQuantile(),
+				Value:    q.GetValue(),
+			})
+		}
+		for _, p := range pts {
+			sp := p.(*metricpb.SummaryDataPoint)
+			out.Count += sp.GetCount()
+			out.Sum += sp.GetSum()
+			for _, q := range sp.GetQuantileValues() {
+				for _, oq := range out.QuantileValues {
+					switch {
+					case q.GetQuantile() == 0 && oq.GetQuantile() == 0:
+						oq.Value = math.Min(oq.Value, q.GetValue())
+					case q.GetQuantile() == 1 && oq.GetQuantile() == 1:
+						oq.Value = math.Max(oq.Value, q.GetValue())
+					}
+				}
+			}
+		}
+		return out
+	case Max:
+		max := pts[0].(*metricpb.SummaryDataPoint)
+		for _, p := range pts[1:] {
+			if sp := p.(*metricpb.SummaryDataPoint); sp.GetSum() > max.GetSum() {
+				max = sp
+			}
+		}
+		return max
+	}
+	return latest(pts)
+}
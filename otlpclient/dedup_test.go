@@ -0,0 +1,220 @@
+package otlpclient
+
+import (
+	"testing"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func metrics(ms ...*metricpb.Metric) []*metricpb.ResourceMetrics {
+	return []*metricpb.ResourceMetrics{{
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{Metrics: ms}},
+	}}
+}
+
+func intPoint(start, end uint64, v int64) *metricpb.NumberDataPoint {
+	return &metricpb.NumberDataPoint{
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Value:             &metricpb.NumberDataPoint_AsInt{AsInt: v},
+	}
+}
+
+func doublePoint(start, end uint64, v float64) *metricpb.NumberDataPoint {
+	return &metricpb.NumberDataPoint{
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Value:             &metricpb.NumberDataPoint_AsDouble{AsDouble: v},
+	}
+}
+
+func gaugeMetric(pts ...*metricpb.NumberDataPoint) *metricpb.Metric {
+	return &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: pts}}}
+}
+
+func histogramMetric(pts ...*metricpb.HistogramDataPoint) *metricpb.Metric {
+	return &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{DataPoints: pts}}}
+}
+
+func summaryMetric(pts ...*metricpb.SummaryDataPoint) *metricpb.Metric {
+	return &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Summary{Summary: &metricpb.Summary{DataPoints: pts}}}
+}
+
+func histogramPoint(end uint64, bounds []float64, counts ...uint64) *metricpb.HistogramDataPoint {
+	p := &metricpb.HistogramDataPoint{StartTimeUnixNano: 1, TimeUnixNano: end, ExplicitBounds: bounds, BucketCounts: counts}
+	for i, n := range counts {
+		p.Count += n
+		if i < len(bounds) {
+			p.Sum += float64(n) * bounds[i]
+		}
+	}
+	return p
+}
+
+func summaryPoint(end uint64, count uint64, sum, min, max float64) *metricpb.SummaryDataPoint {
+	return &metricpb.SummaryDataPoint{
+		StartTimeUnixNano: 1,
+		TimeUnixNano:      end,
+		Count:             count,
+		Sum:               sum,
+		QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{
+			{Quantile: 0, Value: min},
+			{Quantile: 1, Value: max},
+		},
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	bounds := []float64{10, 20}
+	for _, tc := range []struct {
+		name    string
+		reducer Reducer
+		in      *metricpb.Metric
+		want    *metricpb.Metric
+	}{
+		{
+			name: "last", reducer: KeepLast,
+			in:   gaugeMetric(intPoint(1, 3, 5), intPoint(1, 2, 7)),
+			want: gaugeMetric(intPoint(1, 3, 5)),
+		},
+		{
+			name: "sum ints", reducer: Sum,
+			in:   gaugeMetric(intPoint(1, 2, 5), intPoint(2, 3, 7)),
+			want: gaugeMetric(intPoint(1, 3, 12)),
+		},
+		{
+			name: "sum doubles", reducer: Sum,
+			in:   gaugeMetric(intPoint(1, 2, 5), doublePoint(1, 3, 0.5)),
+			want: gaugeMetric(doublePoint(1, 3, 5.5)),
+		},
+		{
+			name: "max", reducer: Max,
+			in:   gaugeMetric(intPoint(1, 2, 5), doublePoint(1, 3, 1.5), intPoint(1, 4, 2)),
+			want: gaugeMetric(intPoint(1, 2, 5)),
+		},
+		{
+			name: "sum histograms", reducer: Sum,
+			in: histogramMetric(histogramPoint(2, bounds, 1, 0, 0), histogramPoint(3, bounds, 0, 2, 1)),
+			want: histogramMetric(&metricpb.HistogramDataPoint{
+				StartTimeUnixNano: 1, TimeUnixNano: 3, Count: 4, Sum: 50,
+				ExplicitBounds: bounds, BucketCounts: []uint64{1, 2, 1},
+			}),
+		},
+		{
+			name: "sum histograms with other bounds", reducer: Sum,
+			in:   histogramMetric(histogramPoint(3, bounds, 1, 0, 0), histogramPoint(2, []float64{5}, 1, 1)),
+			want: histogramMetric(histogramPoint(3, bounds, 1, 0, 0)),
+		},
+		{
+			name: "max histogram", reducer: Max,
+			in:   histogramMetric(histogramPoint(2, bounds, 0, 1, 0), histogramPoint(3, bounds, 1, 0, 0)),
+			want: histogramMetric(histogramPoint(2, bounds, 0, 1, 0)),
+		},
+		{
+			name: "sum summaries", reducer: Sum,
+			in:   summaryMetric(summaryPoint(2, 1, 100, 100, 100), summaryPoint(3, 2, 30, 10, 20)),
+			want: summaryMetric(summaryPoint(3, 3, 130, 10, 100)),
+		},
+		{
+			name: "max summary", reducer: Max,
+			in:   summaryMetric(summaryPoint(2, 1, 100, 100, 100), summaryPoint(3, 2, 30, 10, 20)),
+			want: summaryMetric(summaryPoint(2, 1, 100, 100, 100)),
+		},
+		{
+			name: "to summary", reducer: ToSummary,
+			in: gaugeMetric(intPoint(1, 2, 100), intPoint(2, 3, 20)),
+			want: summaryMetric(&metricpb.SummaryDataPoint{
+				StartTimeUnixNano: 1, TimeUnixNano: 3, Count: 2, Sum: 120,
+				QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{
+					{Quantile: 0, Value: 20},
+					{Quantile: 1, Value: 100},
+				},
+			}),
+		},
+		{
+			name: "to histogram", reducer: ToHistogram,
+			in: gaugeMetric(doublePoint(1, 2, 0.2), doublePoint(1, 3, 20)),
+			want: &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+				AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metricpb.HistogramDataPoint{{
+					StartTimeUnixNano: 1, TimeUnixNano: 3, Count: 2, Sum: 20.2,
+					ExplicitBounds: defaultFloat64Boundaries,
+					BucketCounts:   []uint64{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1},
+				}},
+			}}},
+		},
+		{
+			// A single point is converted too.
+			name: "to histogram of ints", reducer: ToHistogram,
+			in: gaugeMetric(intPoint(1, 2, 7000)),
+			want: &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+				AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metricpb.HistogramDataPoint{{
+					StartTimeUnixNano: 1, TimeUnixNano: 2, Count: 1, Sum: 7000,
+					ExplicitBounds: defaultInt64Boundaries,
+					BucketCounts:   []uint64{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+				}},
+			}}},
+		},
+		{
+			name: "to summary keeps other types", reducer: ToSummary,
+			in:   histogramMetric(histogramPoint(2, bounds, 1, 0, 0), histogramPoint(3, bounds, 0, 1, 0)),
+			want: histogramMetric(histogramPoint(3, bounds, 0, 1, 0)),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewDeduplicating(&fakeClient{}, WithReducer(tc.reducer)).(*deduplicatingClient)
+			in := metrics(tc.in)
+			before := proto.Clone(in[0])
+			got, _ := c.deduplicate(in)
+			if want := metrics(tc.want); !equalPayloads(got, want) {
+				t.Errorf("got  %v\nwant %v", got, want)
+			}
+			if !proto.Equal(in[0], before) {
+				t.Error("the input was modified")
+			}
+		})
+	}
+}
+
+func TestDeduplicateMixedTypes(t *testing.T) {
+	// Two metrics of one name, a Sum and a Histogram, each with a
+	// repeated point.
+	sum := &metricpb.Metric{Name: "m", Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+		DataPoints: []*metricpb.NumberDataPoint{intPoint(1, 2, 1), intPoint(1, 3, 2)},
+	}}}
+	hist := histogramMetric(histogramPoint(2, []float64{10}, 1, 0), histogramPoint(3, []float64{10}, 0, 1))
+	for _, r := range []Reducer{KeepLast, Sum, Max, ToSummary, ToHistogram} {
+		c := NewDeduplicating(&fakeClient{}, WithReducer(r)).(*deduplicatingClient)
+		got, n := c.deduplicate(metrics(sum, hist))
+		if n != 2 {
+			t.Errorf("reducer %d: removed %d points, want 2", r, n)
+		}
+		ms := got[0].GetInstrumentationLibraryMetrics()[0].GetMetrics()
+		if len(ms) != 2 || ms[0].GetSum() == nil || ms[1].GetHistogram() == nil {
+			t.Errorf("reducer %d: got %v, want a Sum and a Histogram", r, ms)
+		}
+	}
+}
+
+func TestDeduplicateUnrepeated(t *testing.T) {
+	c := NewDeduplicating(&fakeClient{}, WithReducer(Sum)).(*deduplicatingClient)
+	in := metrics(gaugeMetric(intPoint(1, 2, 5)))
+	got, n := c.deduplicate(in)
+	if n != 0 || &got[0] != &in[0] {
+		t.Errorf("got %v with %d removed, want the input unchanged", got, n)
+	}
+}
+
+func equalPayloads(a, b []*metricpb.ResourceMetrics) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
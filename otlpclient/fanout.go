@@ -0,0 +1,241 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var (
+	errFanOutStopped  = errors.New("otlpclient: fan-out client stopped")
+	errDestNotStarted = errors.New("not started")
+)
+
+// FanOutPolicy decides when a fan-out operation counts as successful.
+type FanOutPolicy int
+
+const (
+	// AllMustSucceed fails if any destination fails. A caller that sends
+	// the upload again also sends it to the destinations that accepted
+	// it, which may reject the repeated points as duplicates or out of
+	// order; give each destination its own retries instead.
+	AllMustSucceed FanOutPolicy = iota
+	// AnyMustSucceed fails only if every destination fails.
+	AnyMustSucceed
+	// BestEffort never fails. Failures are only reported to the
+	// destination error handler.
+	BestEffort
+)
+
+func (p FanOutPolicy) String() string {
+	switch p {
+	case AllMustSucceed:
+		return "all"
+	case AnyMustSucceed:
+		return "any"
+	case BestEffort:
+		return "best-effort"
+	}
+	return fmt.Sprintf("FanOutPolicy(%d)", int(p))
+}
+
+// Destination is one of the clients a fan-out client sends to.
+type Destination struct {
+	// Name identifies the destination in errors.
+	Name   string
+	Client otlpmetric.Client
+	// Timeout bounds each Start, Stop and UploadMetrics call on this
+	// destination. Zero leaves the caller's deadline alone.
+	Timeout time.Duration
+}
+
+// DestinationError is the failure of a single destination.
+type DestinationError struct {
+	Name string
+	Err  error
+}
+
+func (e DestinationError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+// FanOutError lists the destinations that failed an operation.
+type FanOutError struct {
+	Errors []DestinationError
+}
+
+func (e *FanOutError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, de := range e.Errors {
+		parts[i] = de.Error()
+	}
+	return "fan-out failed: " + strings.Join(parts, "; ")
+}
+
+// Retryable reports whether sending again may succeed: whether some
+// destination failed in a way that is not permanent. A destination that
+// was never started is not retried.
+func (e *FanOutError) Retryable() bool {
+	for _, de := range e.Errors {
+		if !errors.Is(de.Err, errDestNotStarted) && !permanent(de.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// FanOutOption configures a client returned by NewFanOut.
+type FanOutOption func(*fanOutConfig)
+
+type fanOutConfig struct {
+	policy  FanOutPolicy
+	onError func(DestinationError)
+}
+
+// WithPolicy sets the FanOutPolicy. The default is AllMustSucceed.
+func WithPolicy(p FanOutPolicy) FanOutOption {
+	return func(cfg *fanOutConfig) {
+		cfg.policy = p
+	}
+}
+
+// WithDestinationErrorHandler registers fn to be called for every failed
+// destination call, whatever the policy.
+func WithDestinationErrorHandler(fn func(DestinationError)) FanOutOption {
+	return func(cfg *fanOutConfig) {
+		cfg.onError = fn
+	}
+}
+
+type fanOutClient struct {
+	dests []Destination
+	cfg   fanOutConfig
+
+	mu       sync.Mutex
+	started  []bool
+	stopped  bool
+	inFlight sync.WaitGroup
+}
+
+// NewFanOut returns a client that performs every call on all dests
+// concurrently and combines the outcomes according to the policy. A
+// destination that failed to start is skipped by later uploads and
+// reported as failed.
+func NewFanOut(dests []Destination, opts ...FanOutOption) otlpmetric.Client {
+	c := &fanOutClient{
+		dests:   dests,
+		started: make([]bool, len(dests)),
+	}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start starts every destination.
+func (c *fanOutClient) Start(ctx context.Context) error {
+	errs := c.each(ctx, nil, func(ctx context.Context, d Destination) error {
+		return d.Client.Start(ctx)
+	})
+
+	c.mu.Lock()
+	for i := range c.dests {
+		c.started[i] = errs[i] == nil
+	}
+	c.mu.Unlock()
+	return c.result(errs)
+}
+
+// Stop stops every started destination and waits for uploads still in
+// flight to return. Uploads made after Stop fail.
+func (c *fanOutClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopped = true
+	started := append([]bool(nil), c.started...)
+	c.mu.Unlock()
+
+	// Stopping the destinations interrupts their in-flight uploads.
+	errs := c.each(ctx, started, func(ctx context.Context, d Destination) error {
+		return d.Client.Stop(ctx)
+	})
+	c.inFlight.Wait()
+	return c.result(errs)
+}
+
+// UploadMetrics uploads protoMetrics to every started destination.
+func (c *fanOutClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return errFanOutStopped
+	}
+	started := append([]bool(nil), c.started...)
+	c.inFlight.Add(1)
+	c.mu.Unlock()
+	defer c.inFlight.Done()
+
+	errs := c.each(ctx, started, func(ctx context.Context, d Destination) error {
+		return d.Client.UploadMetrics(ctx, protoMetrics)
+	})
+	for i, ok := range started {
+		if !ok {
+			errs[i] = errDestNotStarted
+		}
+	}
+	return c.result(errs)
+}
+
+// each calls fn concurrently for every destination selected by only, or
+// every destination when only is nil, and returns their errors by index.
+func (c *fanOutClient) each(ctx context.Context, only []bool, fn func(context.Context, Destination) error) []error {
+	errs := make([]error, len(c.dests))
+	var wg sync.WaitGroup
+	for i, d := range c.dests {
+		if only != nil && !only[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, d Destination) {
+			defer wg.Done()
+			dctx := ctx
+			if d.Timeout > 0 {
+				var cancel context.CancelFunc
+				dctx, cancel = context.WithTimeout(ctx, d.Timeout)
+				defer cancel()
+			}
+			errs[i] = fn(dctx, d)
+		}(i, d)
+	}
+	wg.Wait()
+	return errs
+}
+
+// result reports each failure and applies the policy.
+func (c *fanOutClient) result(errs []error) error {
+	var failed []DestinationError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		de := DestinationError{Name: c.dests[i].Name, Err: err}
+		failed = append(failed, de)
+		if c.cfg.onError != nil {
+			c.cfg.onError(de)
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		return nil
+	case c.cfg.policy == AllMustSucceed,
+		c.cfg.policy == AnyMustSucceed && len(failed) == len(c.dests):
+		return &FanOutError{Errors: failed}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFanOutPolicies(t *testing.T) {
+	errDown := errors.New("down")
+	for _, tc := range []struct {
+		policy FanOutPolicy
+		// fail lists which of the two destinations fail.
+		fail    [2]bool
+		wantErr bool
+	}{
+		{policy: AllMustSucceed, fail: [2]bool{false, false}},
+		{policy: AllMustSucceed, fail: [2]bool{false, true}, wantErr: true},
+		{policy: AnyMustSucceed, fail: [2]bool{false, true}},
+		{policy: AnyMustSucceed, fail: [2]bool{true, true}, wantErr: true},
+		{policy: BestEffort, fail: [2]bool{true, true}},
+	} {
+		ctx := context.Background()
+		var dests []Destination
+		var clients []*fakeClient
+		for i, fail := range tc.fail {
+			client := &fakeClient{}
+			if fail {
+				client.uploadErrs = []error{errDown}
+			}
+			clients = append(clients, client)
+			dests = append(dests, Destination{Name: string(rune('a' + i)), Client: client})
+		}
+		var mu sync.Mutex
+		var reported []string
+		c := NewFanOut(dests, WithPolicy(tc.policy), WithDestinationErrorHandler(func(de DestinationError) {
+			mu.Lock()
+			reported = append(reported, de.Name)
+			mu.Unlock()
+		}))
+		if err := c.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		err := c.UploadMetrics(ctx, payload("m"))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s with failures %v: got %v, want error %v", tc.policy, tc.fail, err, tc.wantErr)
+		}
+		var fe *FanOutError
+		if err != nil && !errors.As(err, &fe) {
+			t.Errorf("%s: got %T, want *FanOutError", tc.policy, err)
+		}
+		var want []string
+		for i, fail := range tc.fail {
+			if fail {
+				want = append(want, dests[i].Name)
+			}
+		}
+		mu.Lock()
+		if len(reported) == 2 && reported[0] > reported[1] {
+			reported[0], reported[1] = reported[1], reported[0]
+		}
+		if !reflect.DeepEqual(reported, want) {
+			t.Errorf("%s: reported %v, want %v", tc.policy, reported, want)
+		}
+		mu.Unlock()
+
+		if err := c.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for i, client := range clients {
+			if !client.stopped {
+				t.Errorf("%s: destination %d not stopped", tc.policy, i)
+			}
+		}
+	}
+}
+
+func TestFanOutReportsUnstartedDestination(t *testing.T) {
+	ctx := context.Background()
+	broken := &fakeClient{startErr: errors.New("dial failed")}
+	healthy := &fakeClient{}
+	var reported []DestinationError
+	c := NewFanOut([]Destination{
+		{Name: "broken", Client: broken},
+		{Name: "healthy", Client: healthy},
+	}, WithPolicy(AnyMustSucceed), WithDestinationErrorHandler(func(de DestinationError) {
+		reported = append(reported, de)
+	}))
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(reported) != 1 || reported[0].Name != "broken" {
+		t.Fatalf("Start reported %v, want broken", reported)
+	}
+
+	reported = nil
+	if err := c.UploadMetrics(ctx, payload("m")); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 || reported[0].Name != "broken" || reported[0].Err.Error() != "not started" {
+		t.Errorf("upload reported %v, want broken: not started", reported)
+	}
+	if broken.calls != 0 {
+		t.Errorf("unstarted destination received %d uploads", broken.calls)
+	}
+	if healthy.calls != 1 {
+		t.Errorf("healthy destination received %d uploads, want 1", healthy.calls)
+	}
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if broken.stopped {
+		t.Error("unstarted destination was stopped")
+	}
+	if err := c.UploadMetrics(ctx, payload("m")); err != errFanOutStopped {
+		t.Errorf("upload after Stop: got %v, want %v", err, errFanOutStopped)
+	}
+}
+
+func TestFanOutErrorRetryable(t *testing.T) {
+	invalid := status.Error(codes.InvalidArgument, "bad")
+	unavailable := status.Error(codes.Unavailable, "down")
+	for _, tc := range []struct {
+		name string
+		errs []error
+		want bool
+	}{
+		{name: "invalid", errs: []error{invalid}, want: false},
+		{name: "unavailable", errs: []error{unavailable}, want: true},
+		{name: "invalid and unavailable", errs: []error{invalid, unavailable}, want: true},
+		{name: "not started", errs: []error{errDestNotStarted}, want: false},
+	} {
+		e := &FanOutError{}
+		for i, err := range tc.errs {
+			e.Errors = append(e.Errors, DestinationError{Name: string(rune('a' + i)), Err: err})
+		}
+		if got := e.Retryable(); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestQueueDropsPermanentFanOutFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	primary := &fakeClient{}
+	secondary := &fakeClient{uploadErrs: []error{status.Error(codes.InvalidArgument, "bad")}}
+	fanOut := NewFanOut([]Destination{
+		{Name: "primary", Client: primary},
+		{Name: "secondary", Client: secondary},
+	})
+	dropped := make(chan error, 1)
+	q := NewQueued(fanOut, dir, WithDropHandler(func(_ string, err error) { dropped <- err }))
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := q.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-dropped:
+		var fe *FanOutError
+		if !errors.As(err, &fe) {
+			t.Errorf("dropped with %v", err)
+		}
+	default:
+		t.Error("the rejected batch was not reported")
+	}
+	// The batch was not sent again to the destination that accepted it.
+	if got, want := primary.names(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("primary received %v, want %v", got, want)
+	}
+	if got, want := secondary.names(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("secondary received %v, want %v", got, want)
+	}
+}
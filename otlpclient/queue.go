@@ -0,0 +1,384 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	queueSuffix = ".pb"
+	queueTemp   = ".tmp"
+
+	defaultQueueRetryInterval = 5 * time.Second
+)
+
+var errQueueNotStarted = errors.New("otlpclient: queue not started")
+
+// QueueOption configures a client returned by NewQueued.
+type QueueOption func(*queueConfig)
+
+type queueConfig struct {
+	maxBytes      int64
+	retryInterval time.Duration
+	onDrop        func(batch string, err error)
+}
+
+// WithMaxQueueBytes caps the size of the queue directory. When a new batch
+// would take it past n bytes the oldest batches are dropped to make room.
+// Zero, the default, leaves the queue unbounded.
+func WithMaxQueueBytes(n int64) QueueOption {
+	return func(cfg *queueConfig) {
+		cfg.maxBytes = n
+	}
+}
+
+// WithQueueRetryInterval sets how long the queue waits after a failed
+// upload before trying the same batch again. The default is 5s.
+func WithQueueRetryInterval(d time.Duration) QueueOption {
+	return func(cfg *queueConfig) {
+		cfg.retryInterval = d
+	}
+}
+
+// WithDropHandler registers fn to be called for every batch that is
+// discarded, either to respect the size cap or because the wrapped client
+// rejected it permanently.
+func WithDropHandler(fn func(batch string, err error)) QueueOption {
+	return func(cfg *queueConfig) {
+		cfg.onDrop = fn
+	}
+}
+
+// ErrQueueFull is passed to the drop handler for batches discarded to
+// respect WithMaxQueueBytes.
+var ErrQueueFull = errors.New("otlpclient: queue size limit reached")
+
+type queuedBatch struct {
+	name string
+	size int64
+}
+
+// QueuedClient is the client returned by NewQueued. Unlike the other
+// decorators it is exported, so that callers can watch the queue depth
+// through Pending.
+type QueuedClient struct {
+	client otlpmetric.Client
+	dir    string
+	cfg    queueConfig
+
+	mu      sync.Mutex
+	batches []queuedBatch
+	size    int64
+	next    uint64
+	notify  chan struct{}
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+var _ otlpmetric.Client = (*QueuedClient)(nil)
+
+// NewQueued wraps client with a write-ahead log in dir. Every upload is
+// written to its own file and acknowledged once it is on disk; a
+// background loop hands the files to the wrapped client oldest first and
+// deletes each one once it has been accepted. Batches still on disk when
+// the process exits are sent after the next Start.
+//
+// A batch rejected with a gRPC status that retrying cannot fix, or with an
+// error whose Retryable method reports false, is dropped. Any other
+// failure is retried after the retry interval, without limit, and holds
+// back the batches behind it so they arrive in order.
+func NewQueued(client otlpmetric.Client, dir string, opts ...QueueOption) *QueuedClient {
+	c := &QueuedClient{
+		client: client,
+		dir:    dir,
+		cfg:    queueConfig{retryInterval: defaultQueueRetryInterval},
+	}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start recovers the batches left in the directory, starts the wrapped
+// client and begins draining.
+func (c *QueuedClient) Start(ctx context.Context) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	batches, err := c.scan()
+	if err != nil {
+		return err
+	}
+	if err := c.client.Start(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.batches, c.size, c.next = batches, 0, 1
+	for _, b := range batches {
+		c.size += b.size
+		if seq := batchSeq(b.name); seq >= c.next {
+			c.next = seq + 1
+		}
+	}
+	c.notify = make(chan struct{}, 1)
+	c.stopCh = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.drain(c.stopCh, c.done)
+	c.signal()
+	return nil
+}
+
+// scan lists the complete batches in the directory, oldest first, and
+// removes files left half-written by a crash.
+func (c *QueuedClient) scan() ([]queuedBatch, error) {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var batches []queuedBatch
+	for _, fi := range infos {
+		switch {
+		case strings.HasSuffix(fi.Name(), queueTemp):
+			_ = os.Remove(filepath.Join(c.dir, fi.Name()))
+		case strings.HasSuffix(fi.Name(), queueSuffix) && batchSeq(fi.Name()) > 0:
+			batches = append(batches, queuedBatch{name: fi.Name(), size: fi.Size()})
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool { return batchSeq(batches[i].name) < batchSeq(batches[j].name) })
+	return batches, nil
+}
+
+func batchSeq(name string) uint64 {
+	seq, _ := strconv.ParseUint(strings.TrimSuffix(name, queueSuffix), 10, 64)
+	return seq
+}
+
+// Stop keeps draining until the queue is empty or ctx is done, then stops
+// the wrapped client. Batches not sent stay on disk.
+func (c *QueuedClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	stopCh, done := c.stopCh, c.done
+	c.stopCh, c.done = nil, nil
+	c.mu.Unlock()
+
+	if stopCh == nil {
+		return nil
+	}
+
+	var err error
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+wait:
+	for c.pending() > 0 {
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("otlpclient: %d batches left in %s: %w", c.pending(), c.dir, ctx.Err())
+			break wait
+		case <-tick.C:
+		}
+	}
+	close(stopCh)
+	<-done
+
+	if serr := c.client.Stop(ctx); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func (c *QueuedClient) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.batches)
+}
+
+// Pending returns the number of batches waiting in the queue, including
+// one in flight, and their size on disk.
+func (c *QueuedClient) Pending() (batches int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.batches), c.size
+}
+
+// UploadMetrics appends protoMetrics to the log. It returns once the
+// batch is on disk; delivery happens in the background.
+func (c *QueuedClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	b, err := proto.Marshal(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: protoMetrics})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopCh == nil {
+		return errQueueNotStarted
+	}
+	size := int64(len(b))
+	if c.cfg.maxBytes > 0 {
+		// Keep the batch at the head, which drain may be sending.
+		for len(c.batches) > 1 && c.size+size > c.cfg.maxBytes {
+			c.dropLocked(1, ErrQueueFull)
+		}
+	}
+
+	name := fmt.Sprintf("%020d%s", c.next, queueSuffix)
+	if err := writeFileSync(filepath.Join(c.dir, name), b); err != nil {
+		return err
+	}
+	c.next++
+	c.batches = append(c.batches, queuedBatch{name: name, size: size})
+	c.size += size
+	c.signal()
+	return nil
+}
+
+// writeFileSync writes b to a temporary file, syncs it and renames it to
+// filename, so that a crash never leaves a partial batch behind.
+func writeFileSync(filename string, b []byte) error {
+	tmp := filename + queueTemp
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func (c *QueuedClient) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dropLocked removes the i-th batch from the queue and the disk.
+func (c *QueuedClient) dropLocked(i int, reason error) {
+	b := c.batches[i]
+	c.batches = append(c.batches[:i], c.batches[i+1:]...)
+	c.size -= b.size
+	_ = os.Remove(filepath.Join(c.dir, b.name))
+	if c.cfg.onDrop != nil {
+		c.cfg.onDrop(b.name, reason)
+	}
+}
+
+// drain sends batches oldest first until stopCh is closed.
+func (c *QueuedClient) drain(stopCh, done chan struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	for {
+		c.mu.Lock()
+		var head queuedBatch
+		ok := len(c.batches) > 0
+		if ok {
+			head = c.batches[0]
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-stopCh:
+				return
+			case <-c.notify:
+				continue
+			}
+		}
+
+		err := c.send(ctx, head.name)
+		// Only drain removes the head; eviction spares it.
+		c.mu.Lock()
+		switch {
+		case err == nil:
+			c.batches = c.batches[1:]
+			c.size -= head.size
+			_ = os.Remove(filepath.Join(c.dir, head.name))
+		case permanent(err):
+			c.dropLocked(0, err)
+		}
+		c.mu.Unlock()
+
+		if err != nil && !permanent(err) {
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(c.cfg.retryInterval):
+			}
+		}
+	}
+}
+
+func (c *QueuedClient) send(ctx context.Context, name string) error {
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return err
+	}
+	var req colmetricpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("%s: %w", name, errCorrupt)
+	}
+	return c.client.UploadMetrics(ctx, req.GetResourceMetrics())
+}
+
+var errCorrupt = errors.New("corrupt batch")
+
+// permanent reports whether retrying err can never succeed.
+func permanent(err error) bool {
+	if errors.Is(err, errCorrupt) || errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return !r.Retryable()
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.InvalidArgument,
+			codes.Unauthenticated,
+			codes.PermissionDenied,
+			codes.NotFound,
+			codes.AlreadyExists,
+			codes.FailedPrecondition:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventually fails the test if cond does not hold within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueRecoversAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	down := &fakeClient{uploadErrs: []error{status.Error(codes.Unavailable, "down")}}
+	q := NewQueued(down, dir, WithQueueRetryInterval(time.Hour))
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := q.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "the first attempt", func() bool {
+		down.mu.Lock()
+		defer down.mu.Unlock()
+		return down.calls > 0
+	})
+	stopCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := q.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop: got %v, want the batches reported as left behind", err)
+	}
+
+	// A crash while writing leaves a temporary file behind.
+	tmp := filepath.Join(dir, "00000000000000000099"+queueSuffix+queueTemp)
+	if err := ioutil.WriteFile(tmp, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	up := &fakeClient{}
+	q = NewQueued(up, dir)
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file survived Start: %v", err)
+	}
+	if err := q.UploadMetrics(ctx, payload("c")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the queue to drain", func() bool {
+		n, size := q.Pending()
+		return n == 0 && size == 0
+	})
+	if err := q.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := up.names(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	left, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d files left in the queue directory", len(left))
+	}
+}
+
+func TestQueueEvictionKeepsHead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var dropped []string
+	client := &fakeClient{block: make(chan struct{})}
+	q := NewQueued(client, dir,
+		// Room for one batch only.
+		WithMaxQueueBytes(int64(len(mustMarshal(t, payload("a"))))),
+		WithDropHandler(func(batch string, err error) {
+			if !errors.Is(err, ErrQueueFull) {
+				t.Errorf("drop %s: %v", batch, err)
+			}
+			mu.Lock()
+			dropped = append(dropped, batch)
+			mu.Unlock()
+		}))
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := q.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := q.Pending(); n != 2 {
+		t.Errorf("got %d batches queued, want the head and the newest", n)
+	}
+	mu.Lock()
+	if want := []string{batchName(2), batchName(3)}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped %v, want %v", dropped, want)
+	}
+	mu.Unlock()
+
+	close(client.block)
+	if err := q.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.names(), []string{"a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestQueueDropsPermanentFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	dropped := make(chan error, 1)
+	client := &fakeClient{uploadErrs: []error{status.Error(codes.InvalidArgument, "bad")}}
+	q := NewQueued(client, dir, WithDropHandler(func(_ string, err error) { dropped <- err }))
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := q.UploadMetrics(ctx, payload(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-dropped:
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("dropped with %v", err)
+		}
+	default:
+		t.Error("the rejected batch was not reported")
+	}
+	if got, want := client.names(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestQueueNotStarted(t *testing.T) {
+	q := NewQueued(&fakeClient{}, "unused")
+	if err := q.UploadMetrics(context.Background(), payload("a")); err != errQueueNotStarted {
+		t.Errorf("got %v, want %v", err, errQueueNotStarted)
+	}
+}
+
+func batchName(seq int) string {
+	return fmt.Sprintf("%020d%s", seq, queueSuffix)
+}
+
+func mustMarshal(t *testing.T, rms []*metricpb.ResourceMetrics) []byte {
+	t.Helper()
+	b, err := proto.Marshal(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: rms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,83 @@
+package otlpclient_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// backend is an otlpmetric.Client that checks uploads with a gcm.Validator.
+type backend struct {
+	validate func([]*metricpb.ResourceMetrics) error
+	uploads  int
+}
+
+func (b *backend) Start(context.Context) error { return nil }
+
+func (b *backend) Stop(context.Context) error { return nil }
+
+func (b *backend) UploadMetrics(_ context.Context, rms []*metricpb.ResourceMetrics) error {
+	b.uploads++
+	return b.validate(rms)
+}
+
+func TestResendDuplicates(t *testing.T) {
+	cfg := gcm.Config{}
+	for _, tc := range []struct {
+		name  string
+		write bool
+		// uploads counts the first attempt and every resent request, each
+		// of which is a retry.
+		uploads int
+	}{
+		// Only the duplicate fails and is sent again on its own.
+		{name: "validate", uploads: 2},
+		// The first point fails with ReasonInternal too; both are resent,
+		// in separate requests.
+		{name: "write", write: true, uploads: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := gcm.NewValidator(cfg)
+			b := &backend{validate: v.Validate}
+			if tc.write {
+				b.validate = v.Write
+			}
+			resent, retries := 0, 0
+			c := otlpclient.NewRetrying(b,
+				otlpclient.WithRetryClassifier(gcm.Classify),
+				otlpclient.WithRetryBackoff(time.Millisecond, time.Millisecond, time.Second),
+				otlpclient.WithResendSplit(otlpclient.WithSeriesKey(gcm.SeriesKey(cfg))),
+				otlpclient.WithRetryHandler(func(error, time.Duration) { retries++ }),
+				otlpclient.WithRejectHandler(func(r otlpclient.Rejection) otlpclient.RejectAction {
+					if !strings.Contains(r.Reason, gcm.ReasonDuplicate) {
+						t.Errorf("rejected with %q", r.Reason)
+					}
+					resent++
+					return otlpclient.Resend
+				}))
+			ctx := context.Background()
+			if err := c.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Stop(ctx)
+
+			if err := c.UploadMetrics(ctx, gauge("Hello", "Hi")); err != nil {
+				t.Fatal(err)
+			}
+			if resent != 1 {
+				t.Errorf("resent %d points, want 1", resent)
+			}
+			if b.uploads != tc.uploads {
+				t.Errorf("got %d uploads, want %d", b.uploads, tc.uploads)
+			}
+			if retries != b.uploads-1 {
+				t.Errorf("got %d retries for %d uploads", retries, b.uploads)
+			}
+		})
+	}
+}
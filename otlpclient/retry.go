@@ -0,0 +1,370 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errRetryNotStarted = errors.New("otlpclient: retrying client not started")
+
+// disconnectedPrefix starts the error the OTLP gRPC client returns while
+// it is disconnected.
+const disconnectedPrefix = "metrics exporter is disconnected from the server"
+
+// Verdict is a classifier's decision about a failure.
+type Verdict int
+
+const (
+	// Fatal failures are never retried.
+	Fatal Verdict = iota
+	// Retry failures are sent again after a back-off.
+	Retry
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Fatal:
+		return "fatal"
+	case Retry:
+		return "retry"
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// PointFailure is the failure of a single data point of a request.
+type PointFailure struct {
+	// Index counts data points in payload order: resource, instrumentation
+	// library, metric, then point.
+	Index   int
+	Verdict Verdict
+	Reason  string
+}
+
+// Classification is a classifier's reading of a failed upload.
+type Classification struct {
+	// Verdict applies to the whole request when Points is empty.
+	Verdict Verdict
+	// Points, when not empty, reports a partial failure: the listed points
+	// failed and every other point of the request was accepted.
+	Points []PointFailure
+	// Delay is the least time the server asked to wait before retrying.
+	Delay time.Duration
+}
+
+// RetryClassifier inspects the error returned for protoMetrics.
+type RetryClassifier func(err error, protoMetrics []*metricpb.ResourceMetrics) Classification
+
+// DefaultClassifier retries the gRPC codes the OTLP gRPC client retries,
+// and errors whose Retryable method reports true, as a whole. A status
+// wrapped in another error is classified by its code too. A RetryInfo
+// detail of the status sets the delay, whichever decided.
+//
+// After a failed export the OTLP gRPC client considers itself
+// disconnected and, until it reconnects, fails uploads without sending
+// them, returning the earlier status wrapped in a new error. Such errors
+// say nothing about the payload and are retried as a whole.
+func DefaultClassifier(err error, _ []*metricpb.ResourceMetrics) Classification {
+	var se interface{ GRPCStatus() *status.Status }
+	wrapped := errors.As(err, &se)
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		c := Classification{Verdict: Fatal}
+		if r.Retryable() {
+			c.Verdict = Retry
+		}
+		if wrapped {
+			c.Delay = RetryDelay(se.GRPCStatus())
+		}
+		return c
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		if !wrapped {
+			return Classification{Verdict: Fatal}
+		}
+		if strings.HasPrefix(err.Error(), disconnectedPrefix) {
+			return Classification{Verdict: Retry}
+		}
+		st = se.GRPCStatus()
+	}
+	c := Classification{Verdict: Fatal, Delay: RetryDelay(st)}
+	switch st.Code() {
+	case codes.Canceled,
+		codes.DeadlineExceeded,
+		codes.ResourceExhausted,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unavailable,
+		codes.DataLoss:
+		c.Verdict = Retry
+	}
+	return c
+}
+
+// RetryDelay returns the delay of the RetryInfo detail of st, or zero.
+func RetryDelay(st *status.Status) time.Duration {
+	for _, detail := range st.Details() {
+		if ri, ok := detail.(*errdetails.RetryInfo); ok {
+			return ri.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
+
+// RejectAction tells the retrying client what to do with a point that
+// failed fatally in a partially failed request.
+type RejectAction int
+
+const (
+	// Drop discards the point.
+	Drop RejectAction = iota
+	// Resend sends the point again with the retried points, its end time
+	// moved one split interval later, and split so that no request
+	// repeats a series. It suits points rejected only because another
+	// point of the same series shared their request, which the backend
+	// may have written at the original time.
+	Resend
+)
+
+// Rejection is a point that failed fatally.
+type Rejection struct {
+	// Payload holds only the rejected point.
+	Payload []*metricpb.ResourceMetrics
+	Reason  string
+}
+
+// RetryOption configures a client returned by NewRetrying.
+type RetryOption func(*retryConfig)
+
+type retryConfig struct {
+	classify        RetryClassifier
+	onReject        func(Rejection) RejectAction
+	onRetry         func(err error, delay time.Duration)
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	maxElapsedTime  time.Duration
+	split           []SplitOption
+}
+
+// WithRetryClassifier sets the classifier. The default is
+// DefaultClassifier.
+func WithRetryClassifier(fn RetryClassifier) RetryOption {
+	return func(cfg *retryConfig) {
+		cfg.classify = fn
+	}
+}
+
+// WithRejectHandler decides the fate of every point a partially failed
+// request rejected fatally. By default such points are dropped.
+func WithRejectHandler(fn func(Rejection) RejectAction) RetryOption {
+	return func(cfg *retryConfig) {
+		cfg.onReject = fn
+	}
+}
+
+// WithRetryHandler registers fn to be called with the failure and the
+// delay for each request sent again. A retry that resends points split
+// into several requests calls fn once per request, with the delay for
+// the first and zero for the rest.
+func WithRetryHandler(fn func(err error, delay time.Duration)) RetryOption {
+	return func(cfg *retryConfig) {
+		cfg.onRetry = fn
+	}
+}
+
+// WithResendSplit sets how resent points are identified and split, and
+// how far resent points are moved. See Split.
+func WithResendSplit(opts ...SplitOption) RetryOption {
+	return func(cfg *retryConfig) {
+		cfg.split = opts
+	}
+}
+
+// WithRetryBackoff sets the exponential back-off between attempts and the
+// total time an upload may spend retrying. The defaults, 5s, 30s and 1m,
+// match the OTLP gRPC client.
+func WithRetryBackoff(initial, max, maxElapsed time.Duration) RetryOption {
+	return func(cfg *retryConfig) {
+		cfg.initialInterval = initial
+		cfg.maxInterval = max
+		cfg.maxElapsedTime = maxElapsed
+	}
+}
+
+type retryingClient struct {
+	client otlpmetric.Client
+	cfg    retryConfig
+
+	mu     sync.Mutex
+	stopCh chan struct{}
+}
+
+// NewRetrying wraps client, whose own retries should be disabled, with a
+// retry loop driven by a RetryClassifier. A failure of the whole request
+// is retried or returned as the classifier decides. When the classifier
+// reports a partial failure only the points that failed are sent again:
+// those with a Retry verdict, and those the reject handler asks to
+// resend. Resent points are split so that no request repeats a series.
+func NewRetrying(client otlpmetric.Client, opts ...RetryOption) otlpmetric.Client {
+	c := &retryingClient{
+		client: client,
+		cfg: retryConfig{
+			classify:        DefaultClassifier,
+			initialInterval: 5 * time.Second,
+			maxInterval:     30 * time.Second,
+			maxElapsedTime:  time.Minute,
+		},
+	}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Start starts the wrapped client.
+func (c *retryingClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopCh = make(chan struct{})
+	c.mu.Unlock()
+	return c.client.Start(ctx)
+}
+
+// Stop interrupts uploads waiting to retry and stops the wrapped client.
+func (c *retryingClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	if c.stopCh != nil {
+		close(c.stopCh)
+		c.stopCh = nil
+	}
+	c.mu.Unlock()
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics uploads protoMetrics, retrying as classified. Points
+// dropped by the reject handler do not make the upload fail.
+func (c *retryingClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	stopCh := c.stopCh
+	c.mu.Unlock()
+	if stopCh == nil {
+		return errRetryNotStarted
+	}
+
+	expBackoff := &backoff.ExponentialBackOff{
+		InitialInterval:     c.cfg.initialInterval,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+		Multiplier:          backoff.DefaultMultiplier,
+		MaxInterval:         c.cfg.maxInterval,
+		MaxElapsedTime:      c.cfg.maxElapsedTime,
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}
+	expBackoff.Reset()
+
+	type attempt struct {
+		rms   []*metricpb.ResourceMetrics
+		delay time.Duration
+	}
+	pending := []attempt{{rms: protoMetrics}}
+	var errs []string
+	for len(pending) > 0 {
+		a := pending[0]
+		pending = pending[1:]
+		if a.delay > 0 {
+			t := time.NewTimer(a.delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-stopCh:
+				t.Stop()
+				return errors.New("otlpclient: retry interrupted due to shutdown")
+			case <-t.C:
+			}
+		}
+
+		err := c.client.UploadMetrics(ctx, a.rms)
+		if err == nil {
+			continue
+		}
+		resend, serverDelay, ok := c.resend(err, a.rms)
+		if !ok {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if len(resend) == 0 {
+			continue
+		}
+
+		delay := expBackoff.NextBackOff()
+		if delay == backoff.Stop {
+			errs = append(errs, fmt.Sprintf("max elapsed time expired: %v", err))
+			continue
+		}
+		if serverDelay > delay {
+			if expBackoff.GetElapsedTime()+serverDelay > expBackoff.MaxElapsedTime {
+				errs = append(errs, fmt.Sprintf("max elapsed time expired when respecting server throttle: %v", err))
+				continue
+			}
+			delay = serverDelay
+		}
+		for _, rms := range Split(resend, c.cfg.split...) {
+			if c.cfg.onRetry != nil {
+				c.cfg.onRetry(err, delay)
+			}
+			pending = append(pending, attempt{rms: rms, delay: delay})
+			// The splits follow each other without waiting again.
+			delay = 0
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("retried upload failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// resend classifies the failure of rms and returns the points to send
+// again and the delay the server asked for. It reports false when the
+// failure is final.
+func (c *retryingClient) resend(err error, rms []*metricpb.ResourceMetrics) ([]*metricpb.ResourceMetrics, time.Duration, bool) {
+	cl := c.cfg.classify(err, rms)
+	if len(cl.Points) == 0 {
+		return rms, cl.Delay, cl.Verdict == Retry
+	}
+
+	interval := newSplitConfig(c.cfg.split).interval
+	failures := make(map[int]PointFailure, len(cl.Points))
+	for _, pf := range cl.Points {
+		failures[pf.Index] = pf
+	}
+	b := newBuilder()
+	i := 0
+	walk(rms, func(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+		pf, failed := failures[i]
+		i++
+		if !failed {
+			return
+		}
+		if pf.Verdict == Fatal {
+			single := newBuilder()
+			single.add(rm, ilm, m, p)
+			if c.cfg.onReject == nil || c.cfg.onReject(Rejection{Payload: single.payload(), Reason: pf.Reason}) == Drop {
+				return
+			}
+			p = later(p, interval)
+		}
+		b.add(rm, ilm, m, p)
+	})
+	return b.payload(), cl.Delay, true
+}
@@ -0,0 +1,127 @@
+package otlpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestRetryGivesUpAtMaxElapsedTime(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{err: status.Error(codes.Unavailable, "down")}
+	var retries int
+	c := NewRetrying(client,
+		WithRetryBackoff(time.Millisecond, time.Millisecond, 50*time.Millisecond),
+		WithRetryHandler(func(error, time.Duration) { retries++ }))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(ctx)
+
+	err := c.UploadMetrics(ctx, payload("m"))
+	if err == nil || !strings.Contains(err.Error(), "max elapsed time expired") {
+		t.Fatalf("got %v, want the max elapsed time to expire", err)
+	}
+	if client.calls < 2 || retries != client.calls-1 {
+		t.Errorf("got %d attempts and %d retries", client.calls, retries)
+	}
+}
+
+func TestRetryFatal(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{err: status.Error(codes.InvalidArgument, "bad")}
+	c := NewRetrying(client, WithRetryBackoff(time.Millisecond, time.Millisecond, time.Second))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(ctx)
+
+	if err := c.UploadMetrics(ctx, payload("m")); err == nil {
+		t.Fatal("fatal failure was not returned")
+	}
+	if client.calls != 1 {
+		t.Errorf("got %d attempts, want 1", client.calls)
+	}
+}
+
+func TestRetryStopInterruptsWait(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{uploadErrs: []error{status.Error(codes.Unavailable, "down")}}
+	c := NewRetrying(client, WithRetryBackoff(time.Hour, time.Hour, 2*time.Hour))
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.UploadMetrics(ctx, payload("m"))
+	}()
+	eventually(t, "the first attempt", func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.calls == 1
+	})
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "interrupted due to shutdown") {
+			t.Errorf("got %v, want the retry interrupted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not interrupt the wait")
+	}
+}
+
+func TestRetryNotStarted(t *testing.T) {
+	c := NewRetrying(&fakeClient{})
+	if err := c.UploadMetrics(context.Background(), payload("m")); !errors.Is(err, errRetryNotStarted) {
+		t.Errorf("got %v, want %v", err, errRetryNotStarted)
+	}
+}
+
+type retryableError bool
+
+func (e retryableError) Error() string   { return "retryable" }
+func (e retryableError) Retryable() bool { return bool(e) }
+
+func TestDefaultClassifier(t *testing.T) {
+	throttled, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(3 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		err   error
+		want  Verdict
+		delay time.Duration
+	}{
+		{name: "unavailable", err: status.Error(codes.Unavailable, "down"), want: Retry},
+		{name: "invalid", err: status.Error(codes.InvalidArgument, "bad"), want: Fatal},
+		{name: "throttled", err: throttled.Err(), want: Retry, delay: 3 * time.Second},
+		{name: "wrapped unavailable", err: fmt.Errorf("upload: %w", status.Error(codes.Unavailable, "down")), want: Retry},
+		{name: "wrapped invalid", err: fmt.Errorf("upload: %w", status.Error(codes.InvalidArgument, "bad")), want: Fatal},
+		{name: "disconnected", err: fmt.Errorf("%s localhost:4317: %w", disconnectedPrefix, status.Error(codes.InvalidArgument, "bad")), want: Retry},
+		{name: "retryable", err: fmt.Errorf("upload: %w", retryableError(true)), want: Retry},
+		{name: "not retryable", err: retryableError(false), want: Fatal},
+		{name: "plain", err: errors.New("boom"), want: Fatal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultClassifier(tc.err, nil)
+			if c.Verdict != tc.want || c.Delay != tc.delay {
+				t.Errorf("got %v after %v, want %v after %v", c.Verdict, c.Delay, tc.want, tc.delay)
+			}
+		})
+	}
+}
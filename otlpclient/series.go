@@ -0,0 +1,220 @@
+// Package otlpclient provides otlpmetric.Client decorators that reshape
+// uploads before they reach the wrapped client.
+package otlpclient
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// DataPoint is implemented by every OTLP data point type.
+type DataPoint interface {
+	proto.Message
+	GetAttributes() []*commonpb.KeyValue
+	GetLabels() []*commonpb.StringKeyValue
+	GetStartTimeUnixNano() uint64
+	GetTimeUnixNano() uint64
+}
+
+// Points returns the data points of m, whatever its data type.
+func Points(m *metricpb.Metric) []DataPoint {
+	var pts []DataPoint
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			pts = append(pts, p)
+		}
+	case *metricpb.Metric_Sum:
+		for _, p := range data.Sum.GetDataPoints() {
+			pts = append(pts, p)
+		}
+	case *metricpb.Metric_Histogram:
+		for _, p := range data.Histogram.GetDataPoints() {
+			pts = append(pts, p)
+		}
+	case *metricpb.Metric_Summary:
+		for _, p := range data.Summary.GetDataPoints() {
+			pts = append(pts, p)
+		}
+	}
+	return pts
+}
+
+// PointCount returns the number of data points in rms.
+func PointCount(rms []*metricpb.ResourceMetrics) int {
+	n := 0
+	walk(rms, func(*metricpb.ResourceMetrics, *metricpb.InstrumentationLibraryMetrics, *metricpb.Metric, DataPoint) {
+		n++
+	})
+	return n
+}
+
+// Timestamps returns the start and end time fields of p, so that they can
+// be changed in place.
+func Timestamps(p DataPoint) (start, end *uint64) {
+	switch p := p.(type) {
+	case *metricpb.NumberDataPoint:
+		return &p.StartTimeUnixNano, &p.TimeUnixNano
+	case *metricpb.HistogramDataPoint:
+		return &p.StartTimeUnixNano, &p.TimeUnixNano
+	case *metricpb.SummaryDataPoint:
+		return &p.StartTimeUnixNano, &p.TimeUnixNano
+	}
+	return new(uint64), new(uint64)
+}
+
+// later returns a copy of p with its end time moved d later.
+func later(p DataPoint, d time.Duration) DataPoint {
+	p = proto.Clone(p).(DataPoint)
+	_, end := Timestamps(p)
+	*end += uint64(d)
+	return p
+}
+
+// walk calls fn for every data point in rms, in payload order.
+func walk(rms []*metricpb.ResourceMetrics, fn func(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint)) {
+	for _, rm := range rms {
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				for _, p := range Points(m) {
+					fn(rm, ilm, m, p)
+				}
+			}
+		}
+	}
+}
+
+// seriesKey identifies the series a point belongs to: its resource,
+// instrumentation library, metric name and attributes.
+func seriesKey(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) string {
+	var b strings.Builder
+	writeAttributes(&b, rm.GetResource().GetAttributes())
+	b.WriteString(ilm.GetInstrumentationLibrary().GetName())
+	b.WriteByte('@')
+	b.WriteString(ilm.GetInstrumentationLibrary().GetVersion())
+	b.WriteByte('/')
+	b.WriteString(m.GetName())
+	writeAttributes(&b, p.GetAttributes())
+	return b.String()
+}
+
+// scopeKey identifies a resource and instrumentation library pair.
+func scopeKey(res *resourcepb.Resource, lib *commonpb.InstrumentationLibrary) string {
+	var b strings.Builder
+	writeAttributes(&b, res.GetAttributes())
+	b.WriteString(lib.GetName())
+	b.WriteByte('@')
+	b.WriteString(lib.GetVersion())
+	return b.String()
+}
+
+func writeAttributes(b *strings.Builder, attrs []*commonpb.KeyValue) {
+	sorted := make([]*commonpb.KeyValue, len(attrs))
+	copy(sorted, attrs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].GetKey() < sorted[j].GetKey() })
+
+	b.WriteByte('{')
+	for _, kv := range sorted {
+		enc, _ := proto.MarshalOptions{Deterministic: true}.Marshal(kv)
+		b.Write(enc)
+		b.WriteByte(',')
+	}
+	b.WriteByte('}')
+}
+
+// builder reassembles a payload from individual points, keeping the
+// resource, instrumentation library and metric grouping of the source.
+type builder struct {
+	// shell creates the empty destination for a source metric. It
+	// defaults to emptyMetric.
+	shell func(*metricpb.Metric) *metricpb.Metric
+
+	rms  []*metricpb.ResourceMetrics
+	rm   map[*metricpb.ResourceMetrics]*metricpb.ResourceMetrics
+	ilm  map[*metricpb.InstrumentationLibraryMetrics]*metricpb.InstrumentationLibraryMetrics
+	m    map[*metricpb.Metric]*metricpb.Metric
+	size int
+}
+
+func newBuilder() *builder {
+	return &builder{
+		shell: emptyMetric,
+		rm:    make(map[*metricpb.ResourceMetrics]*metricpb.ResourceMetrics),
+		ilm:   make(map[*metricpb.InstrumentationLibraryMetrics]*metricpb.InstrumentationLibraryMetrics),
+		m:     make(map[*metricpb.Metric]*metricpb.Metric),
+	}
+}
+
+// add appends p to the copy of m, creating the enclosing messages on
+// first use.
+func (b *builder) add(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+	dstRM, ok := b.rm[rm]
+	if !ok {
+		dstRM = &metricpb.ResourceMetrics{Resource: rm.GetResource()}
+		b.rm[rm] = dstRM
+		b.rms = append(b.rms, dstRM)
+	}
+	dstILM, ok := b.ilm[ilm]
+	if !ok {
+		dstILM = &metricpb.InstrumentationLibraryMetrics{InstrumentationLibrary: ilm.GetInstrumentationLibrary()}
+		b.ilm[ilm] = dstILM
+		dstRM.InstrumentationLibraryMetrics = append(dstRM.InstrumentationLibraryMetrics, dstILM)
+	}
+	dstM, ok := b.m[m]
+	if !ok {
+		dstM = b.shell(m)
+		b.m[m] = dstM
+		dstILM.Metrics = append(dstILM.Metrics, dstM)
+	}
+	appendPoint(dstM, p)
+	b.size++
+}
+
+// payload returns the assembled ResourceMetrics.
+func (b *builder) payload() []*metricpb.ResourceMetrics {
+	return b.rms
+}
+
+// emptyMetric copies the descriptor and data type of m without its points.
+func emptyMetric(m *metricpb.Metric) *metricpb.Metric {
+	out := &metricpb.Metric{
+		Name:        m.GetName(),
+		Description: m.GetDescription(),
+		Unit:        m.GetUnit(),
+	}
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}
+	case *metricpb.Metric_Sum:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: data.Sum.GetAggregationTemporality(),
+			IsMonotonic:            data.Sum.GetIsMonotonic(),
+		}}
+	case *metricpb.Metric_Histogram:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: data.Histogram.GetAggregationTemporality(),
+		}}
+	case *metricpb.Metric_Summary:
+		out.Data = &metricpb.Metric_Summary{Summary: &metricpb.Summary{}}
+	}
+	return out
+}
+
+func appendPoint(m *metricpb.Metric, p DataPoint) {
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		data.Gauge.DataPoints = append(data.Gauge.DataPoints, p.(*metricpb.NumberDataPoint))
+	case *metricpb.Metric_Sum:
+		data.Sum.DataPoints = append(data.Sum.DataPoints, p.(*metricpb.NumberDataPoint))
+	case *metricpb.Metric_Histogram:
+		data.Histogram.DataPoints = append(data.Histogram.DataPoints, p.(*metricpb.HistogramDataPoint))
+	case *metricpb.Metric_Summary:
+		data.Summary.DataPoints = append(data.Summary.DataPoints, p.(*metricpb.SummaryDataPoint))
+	}
+}
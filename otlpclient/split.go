@@ -0,0 +1,140 @@
+package otlpclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// SeriesKeyFunc returns the identity of the series of the only point in
+// payload. Points with equal keys belong to the same series.
+type SeriesKeyFunc func(payload []*metricpb.ResourceMetrics) string
+
+// SplitOption configures Split and the client returned by NewSplitting.
+type SplitOption func(*splitConfig)
+
+type splitConfig struct {
+	key      SeriesKeyFunc
+	interval time.Duration
+}
+
+// WithSeriesKey sets how the series of a point is identified. By default
+// a series is a resource, instrumentation library, metric name and
+// attribute set. A backend that maps points onto series differently, such
+// as one that ignores some attributes, needs its own identity.
+func WithSeriesKey(fn SeriesKeyFunc) SplitOption {
+	return func(cfg *splitConfig) {
+		cfg.key = fn
+	}
+}
+
+// WithSplitInterval sets how far apart the end times of consecutive
+// points of a series are moved. The default is a millisecond.
+func WithSplitInterval(d time.Duration) SplitOption {
+	return func(cfg *splitConfig) {
+		cfg.interval = d
+	}
+}
+
+func newSplitConfig(opts []SplitOption) splitConfig {
+	cfg := splitConfig{interval: time.Millisecond}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+type splittingClient struct {
+	client otlpmetric.Client
+	opts   []SplitOption
+}
+
+// NewSplitting wraps client so that every series appears at most once per
+// request. An upload carrying several points for the same series is sent
+// as a sequence of requests, the n-th of which holds the n-th point of
+// each series.
+func NewSplitting(client otlpmetric.Client, opts ...SplitOption) otlpmetric.Client {
+	return &splittingClient{client: client, opts: opts}
+}
+
+// Start starts the wrapped client.
+func (c *splittingClient) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *splittingClient) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics uploads each split of protoMetrics in turn. Every split is
+// attempted even if an earlier one fails; the failures are returned
+// together.
+func (c *splittingClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	splits := Split(protoMetrics, c.opts...)
+	if len(splits) == 1 {
+		return c.client.UploadMetrics(ctx, splits[0])
+	}
+
+	var errs []string
+	for i, rms := range splits {
+		if err := c.client.UploadMetrics(ctx, rms); err != nil {
+			errs = append(errs, fmt.Sprintf("request %d of %d: %v", i+1, len(splits), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("split upload failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Split divides rms into the smallest number of payloads in which no
+// series has more than one point. A payload without repeated series is
+// returned unchanged as the only element.
+//
+// A backend that keeps one point per series and time, and only accepts
+// points newer than the last one written, would reject every payload but
+// the first if they kept their timestamps. So the end time of the point
+// placed in the n-th payload is moved n split intervals later; the points
+// of the first payload keep theirs.
+func Split(rms []*metricpb.ResourceMetrics, opts ...SplitOption) [][]*metricpb.ResourceMetrics {
+	cfg := newSplitConfig(opts)
+	seen := make(map[string]int)
+	var builders []*builder
+	walk(rms, func(rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) {
+		key := pointKey(cfg.key, rm, ilm, m, p)
+		n := seen[key]
+		seen[key] = n + 1
+		if n == len(builders) {
+			builders = append(builders, newBuilder())
+		}
+		if n > 0 {
+			p = later(p, time.Duration(n)*cfg.interval)
+		}
+		builders[n].add(rm, ilm, m, p)
+	})
+
+	if len(builders) <= 1 {
+		return [][]*metricpb.ResourceMetrics{rms}
+	}
+	out := make([][]*metricpb.ResourceMetrics, len(builders))
+	for i, b := range builders {
+		out[i] = b.payload()
+	}
+	return out
+}
+
+// pointKey returns the series of p as fn identifies it, or the default
+// identity when fn is nil.
+func pointKey(fn SeriesKeyFunc, rm *metricpb.ResourceMetrics, ilm *metricpb.InstrumentationLibraryMetrics, m *metricpb.Metric, p DataPoint) string {
+	if fn == nil {
+		return seriesKey(rm, ilm, m, p)
+	}
+	single := newBuilder()
+	single.add(rm, ilm, m, p)
+	return fn(single.payload())
+}
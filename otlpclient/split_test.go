@@ -0,0 +1,99 @@
+package otlpclient_test
+
+import (
+	"testing"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/gcm"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const end = 1629948057000000000
+
+// gauge returns a payload with one gauge point per method, all at end.
+func gauge(methods ...string) []*metricpb.ResourceMetrics {
+	var pts []*metricpb.NumberDataPoint
+	for i, method := range methods {
+		pts = append(pts, &metricpb.NumberDataPoint{
+			Attributes: []*commonpb.KeyValue{{
+				Key:   "rpc.method",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: method}},
+			}},
+			StartTimeUnixNano: end - 2e9,
+			TimeUnixNano:      end,
+			Value:             &metricpb.NumberDataPoint_AsInt{AsInt: int64(i)},
+		})
+	}
+	return []*metricpb.ResourceMetrics{{
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricpb.Metric{{
+				Name: "test.dummy.one",
+				Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: pts}},
+			}},
+		}},
+	}}
+}
+
+func TestSplitValidates(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    gcm.Config
+		opts   []otlpclient.SplitOption
+		rms    []*metricpb.ResourceMetrics
+		splits int
+	}{
+		{
+			name:   "repeated attributes",
+			cfg:    gcm.Config{PointAttributes: true},
+			rms:    gauge("Hello", "Hi", "Hi", "Hi"),
+			splits: 3,
+		},
+		{
+			name:   "attributes the backend ignores",
+			opts:   []otlpclient.SplitOption{otlpclient.WithSeriesKey(gcm.SeriesKey(gcm.Config{}))},
+			rms:    gauge("Hello", "Hi"),
+			splits: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := gcm.NewValidator(tc.cfg).Validate(tc.rms); err == nil {
+				t.Fatal("unsplit payload passed validation")
+			}
+
+			splits := otlpclient.Split(tc.rms, tc.opts...)
+			if len(splits) != tc.splits {
+				t.Fatalf("got %d splits, want %d", len(splits), tc.splits)
+			}
+			v := gcm.NewValidator(tc.cfg)
+			for i, rms := range splits {
+				if err := v.Validate(rms); err != nil {
+					t.Errorf("split %d: %v", i, err)
+				}
+			}
+			for _, p := range tc.rms[0].InstrumentationLibraryMetrics[0].Metrics[0].GetGauge().GetDataPoints() {
+				if p.TimeUnixNano != end {
+					t.Errorf("source point moved to %d", p.TimeUnixNano)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitInterval(t *testing.T) {
+	splits := otlpclient.Split(gauge("Hi", "Hi", "Hi"), otlpclient.WithSplitInterval(5))
+	for i, rms := range splits {
+		got := rms[0].InstrumentationLibraryMetrics[0].Metrics[0].GetGauge().GetDataPoints()[0].TimeUnixNano
+		if want := uint64(end + 5*i); got != want {
+			t.Errorf("split %d: end time %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestSplitUnchanged(t *testing.T) {
+	rms := gauge("Hello", "Hi")
+	splits := otlpclient.Split(rms)
+	if len(splits) != 1 || &splits[0][0] != &rms[0] {
+		t.Errorf("payload without repeated series was not returned as is")
+	}
+}
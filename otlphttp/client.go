@@ -0,0 +1,327 @@
+package otlphttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+
+	// maxErrorBody bounds how much of an error response is read.
+	maxErrorBody = 64 << 10
+)
+
+var errNotStarted = errors.New("otlphttp: client not started")
+
+// StatusError is returned when the collector answers with a non-2xx
+// status. Message is taken from the google.rpc.Status body if there is
+// one, otherwise from the raw body.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	// Status is the google.rpc.Status body, if there was one.
+	Status *spb.Status
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("otlphttp: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Retryable reports whether the status is one the OTLP/HTTP specification
+// allows the client to retry.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// GRPCStatus lets status.FromError, and the classifiers built on it, read
+// e like a gRPC failure. It returns the google.rpc.Status body, or else a
+// status with the code gRPC maps the HTTP status to. Retry-After becomes
+// a RetryInfo detail unless the body has one.
+func (e *StatusError) GRPCStatus() *status.Status {
+	st := status.New(httpStatusCode(e.StatusCode), e.Message)
+	if e.Status != nil {
+		st = status.FromProto(e.Status)
+	}
+	if e.RetryAfter <= 0 {
+		return st
+	}
+	for _, detail := range st.Details() {
+		if _, ok := detail.(*errdetails.RetryInfo); ok {
+			return st
+		}
+	}
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)}); err == nil {
+		return detailed
+	}
+	return st
+}
+
+// httpStatusCode maps an HTTP status to a gRPC code as gRPC does for
+// responses that carry no grpc-status.
+func httpStatusCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+type client struct {
+	cfg config
+	url string
+
+	mu     sync.Mutex
+	http   *http.Client
+	stopCh chan struct{}
+}
+
+// NewClient returns an otlpmetric.Client that POSTs every upload as one
+// ExportMetricsServiceRequest.
+func NewClient(opts ...Option) otlpmetric.Client {
+	cfg := newConfig(opts)
+	scheme := "https"
+	if cfg.insecure {
+		scheme = "http"
+	}
+	return &client{
+		cfg: cfg,
+		url: scheme + "://" + cfg.endpoint + cfg.urlPath,
+	}
+}
+
+// Start prepares the HTTP transport.
+func (c *client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.cfg.tlsConfig != nil {
+		transport.TLSClientConfig = c.cfg.tlsConfig
+	}
+	c.http = &http.Client{Transport: transport}
+	c.stopCh = make(chan struct{})
+	return nil
+}
+
+// Stop interrupts pending retries and closes idle connections.
+func (c *client) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.http == nil {
+		return nil
+	}
+	close(c.stopCh)
+	c.http.CloseIdleConnections()
+	c.http, c.stopCh = nil, nil
+	return nil
+}
+
+// UploadMetrics sends protoMetrics, retrying as configured.
+func (c *client) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	hc, stopCh := c.http, c.stopCh
+	c.mu.Unlock()
+	if hc == nil {
+		return errNotStarted
+	}
+
+	body, err := c.encode(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: protoMetrics})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.timeout)
+	defer cancel()
+
+	expBackoff := newExponentialBackoff(c.cfg.retry)
+	for {
+		err := c.send(ctx, hc, body)
+		if err == nil || !c.cfg.retry.Enabled {
+			return err
+		}
+		var se *StatusError
+		if !errors.As(err, &se) || !se.Retryable() {
+			return err
+		}
+
+		delay := expBackoff.NextBackOff()
+		if delay == backoff.Stop {
+			return fmt.Errorf("max elapsed time expired: %w", err)
+		}
+		if se.RetryAfter > delay {
+			if expBackoff.GetElapsedTime()+se.RetryAfter > expBackoff.MaxElapsedTime {
+				return fmt.Errorf("max elapsed time expired when respecting Retry-After: %w", err)
+			}
+			delay = se.RetryAfter
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-stopCh:
+			t.Stop()
+			return fmt.Errorf("interrupted due to shutdown: %w", err)
+		case <-t.C:
+		}
+	}
+}
+
+func (c *client) encode(req *colmetricpb.ExportMetricsServiceRequest) ([]byte, error) {
+	var b []byte
+	var err error
+	if c.cfg.encoding == JSONEncoding {
+		b, err = protojson.Marshal(req)
+	} else {
+		b, err = proto.Marshal(req)
+	}
+	if err != nil || c.cfg.compression != GzipCompression {
+		return b, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *client) send(ctx context.Context, hc *http.Client, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range c.cfg.headers {
+		req.Header.Set(k, v)
+	}
+	if c.cfg.encoding == JSONEncoding {
+		req.Header.Set("Content-Type", contentTypeJSON)
+	} else {
+		req.Header.Set("Content-Type", contentTypeProtobuf)
+	}
+	if c.cfg.compression == GzipCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	se := &StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(b)),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		Status:     errorStatus(resp.Header.Get("Content-Type"), b),
+	}
+	if se.Status != nil {
+		se.Message = se.Status.GetMessage()
+	}
+	return se
+}
+
+// errorStatus decodes a google.rpc.Status body, or returns nil.
+func errorStatus(contentType string, body []byte) *spb.Status {
+	st := &spb.Status{}
+	switch {
+	case strings.HasPrefix(contentType, contentTypeProtobuf):
+		if proto.Unmarshal(body, st) == nil {
+			return st
+		}
+	case strings.HasPrefix(contentType, contentTypeJSON):
+		if protojson.Unmarshal(body, st) == nil {
+			return st
+		}
+	}
+	return nil
+}
+
+// retryAfter parses a Retry-After header given either as seconds or as an
+// HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func newExponentialBackoff(rs RetrySettings) *backoff.ExponentialBackOff {
+	expBackoff := &backoff.ExponentialBackOff{
+		InitialInterval:     rs.InitialInterval,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+		Multiplier:          backoff.DefaultMultiplier,
+		MaxInterval:         rs.MaxInterval,
+		MaxElapsedTime:      rs.MaxElapsedTime,
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}
+	expBackoff.Reset()
+	return expBackoff
+}
@@ -0,0 +1,250 @@
+package otlphttp
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var testMetrics = []*metricpb.ResourceMetrics{{InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+	Metrics: []*metricpb.Metric{{Name: "test.dummy.one", Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+		DataPoints: []*metricpb.NumberDataPoint{{Value: &metricpb.NumberDataPoint_AsInt{AsInt: 1}}},
+	}}}},
+}}}}
+
+// fastRetry retries without waiting, apart from any Retry-After.
+var fastRetry = RetrySettings{
+	Enabled:         true,
+	InitialInterval: time.Millisecond,
+	MaxInterval:     time.Millisecond,
+	MaxElapsedTime:  5 * time.Second,
+}
+
+// collector is an OTLP/HTTP receiver answering each request with the next
+// of its responses, and with 200 once they run out.
+type collector struct {
+	t         *testing.T
+	responses []func(http.ResponseWriter)
+
+	mu       sync.Mutex
+	requests []*colmetricpb.ExportMetricsServiceRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != DefaultMetricsPath {
+		c.t.Errorf("got path %q, want %q", r.URL.Path, DefaultMetricsPath)
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			c.t.Error(err)
+			return
+		}
+		body = zr
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		c.t.Error(err)
+		return
+	}
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	if r.Header.Get("Content-Type") == contentTypeJSON {
+		err = protojson.Unmarshal(b, req)
+	} else {
+		err = proto.Unmarshal(b, req)
+	}
+	if err != nil {
+		c.t.Error(err)
+	}
+
+	c.mu.Lock()
+	n := len(c.requests)
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+	if n < len(c.responses) {
+		c.responses[n](w)
+	}
+}
+
+// upload sends testMetrics to a collector answering with responses.
+func upload(t *testing.T, responses []func(http.ResponseWriter), opts ...Option) (*collector, error) {
+	t.Helper()
+	c := &collector{t: t, responses: responses}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	client := NewClient(append([]Option{
+		WithEndpoint(strings.TrimPrefix(srv.URL, "http://")),
+		WithInsecure(),
+		WithRetry(fastRetry),
+	}, opts...)...)
+	ctx := context.Background()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop(ctx)
+	return c, client.UploadMetrics(ctx, testMetrics)
+}
+
+func respond(code int, header ...string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func TestUploadEncodings(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		opts            []Option
+		contentType     string
+		contentEncoding string
+	}{
+		{name: "protobuf", contentType: contentTypeProtobuf},
+		{name: "JSON", opts: []Option{WithEncoding(JSONEncoding)}, contentType: contentTypeJSON},
+		{
+			name:            "gzip",
+			opts:            []Option{WithCompression(GzipCompression)},
+			contentType:     contentTypeProtobuf,
+			contentEncoding: "gzip",
+		},
+		{
+			name:            "JSON gzip",
+			opts:            []Option{WithEncoding(JSONEncoding), WithCompression(GzipCompression)},
+			contentType:     contentTypeJSON,
+			contentEncoding: "gzip",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append(tc.opts, WithHeaders(map[string]string{"X-Test": "1"}))
+			c, err := upload(t, nil, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(c.requests))
+			}
+			want := &colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: testMetrics}
+			if !proto.Equal(c.requests[0], want) {
+				t.Errorf("got %v, want %v", c.requests[0], want)
+			}
+			h := c.headers[0]
+			if got := h.Get("Content-Type"); got != tc.contentType {
+				t.Errorf("got Content-Type %q, want %q", got, tc.contentType)
+			}
+			if got := h.Get("Content-Encoding"); got != tc.contentEncoding {
+				t.Errorf("got Content-Encoding %q, want %q", got, tc.contentEncoding)
+			}
+			if got := h.Get("X-Test"); got != "1" {
+				t.Errorf("got X-Test %q, want 1", got)
+			}
+		})
+	}
+}
+
+func TestUploadRetries(t *testing.T) {
+	for _, code := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(code), func(t *testing.T) {
+			c, err := upload(t, []func(http.ResponseWriter){respond(code), respond(code)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.requests) != 3 {
+				t.Errorf("got %d requests, want 3", len(c.requests))
+			}
+		})
+	}
+}
+
+func TestUploadRetryAfter(t *testing.T) {
+	start := time.Now()
+	c, err := upload(t, []func(http.ResponseWriter){respond(http.StatusTooManyRequests, "Retry-After", "1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.requests) != 2 {
+		t.Errorf("got %d requests, want 2", len(c.requests))
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want Retry-After of 1s", elapsed)
+	}
+
+	// A Retry-After beyond MaxElapsedTime fails at once.
+	_, err = upload(t, []func(http.ResponseWriter){respond(http.StatusServiceUnavailable, "Retry-After", "60")})
+	var se *StatusError
+	if !errors.As(err, &se) || se.RetryAfter != time.Minute {
+		t.Errorf("got %v, want a StatusError with RetryAfter 1m", err)
+	}
+}
+
+func TestUploadStatusError(t *testing.T) {
+	body, err := protojson.Marshal(&spb.Status{Code: int32(codes.InvalidArgument), Message: "bad points"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		response func(http.ResponseWriter)
+		message  string
+		code     codes.Code
+	}{
+		{
+			name: "google.rpc.Status",
+			response: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", contentTypeJSON)
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(body)
+			},
+			message: "bad points",
+			code:    codes.InvalidArgument,
+		},
+		{
+			name: "plain text",
+			response: func(w http.ResponseWriter) {
+				http.Error(w, "no such tenant", http.StatusNotFound)
+			},
+			message: "no such tenant",
+			code:    codes.Unimplemented,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := upload(t, []func(http.ResponseWriter){tc.response})
+			var se *StatusError
+			if !errors.As(err, &se) {
+				t.Fatalf("got %v, want a StatusError", err)
+			}
+			if len(c.requests) != 1 {
+				t.Errorf("got %d requests, want 1", len(c.requests))
+			}
+			if se.Retryable() {
+				t.Error("4xx reported retryable")
+			}
+			if se.Message != tc.message {
+				t.Errorf("got message %q, want %q", se.Message, tc.message)
+			}
+			if got := se.GRPCStatus().Code(); got != tc.code {
+				t.Errorf("got code %v, want %v", got, tc.code)
+			}
+		})
+	}
+}
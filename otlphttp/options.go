@@ -0,0 +1,147 @@
+// Package otlphttp provides an otlpmetric.Client that sends metrics to a
+// collector's OTLP/HTTP receiver as binary protobuf or JSON.
+package otlphttp
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+const (
+	// DefaultEndpoint is the collector's legacy OTLP/HTTP address.
+	DefaultEndpoint = "localhost:55681"
+	// DefaultMetricsPath is the URL path metrics are POSTed to.
+	DefaultMetricsPath = "/v1/metrics"
+	// DefaultTimeout bounds a single upload, including retries.
+	DefaultTimeout = 10 * time.Second
+)
+
+// Encoding is the body encoding of an export request.
+type Encoding int
+
+const (
+	// ProtobufEncoding sends application/x-protobuf bodies.
+	ProtobufEncoding Encoding = iota
+	// JSONEncoding sends application/json bodies.
+	JSONEncoding
+)
+
+// Compression is the body compression of an export request.
+type Compression int
+
+const (
+	// NoCompression sends bodies as they are.
+	NoCompression Compression = iota
+	// GzipCompression sends gzip-compressed bodies.
+	GzipCompression
+)
+
+// RetrySettings configures exponential back-off for uploads rejected with
+// a retryable HTTP status. A Retry-After header longer than the next
+// back-off is honoured as long as it fits within MaxElapsedTime.
+type RetrySettings struct {
+	Enabled         bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}
+
+// DefaultRetrySettings matches the defaults of the gRPC client.
+var DefaultRetrySettings = RetrySettings{
+	Enabled:         true,
+	InitialInterval: 5 * time.Second,
+	MaxInterval:     30 * time.Second,
+	MaxElapsedTime:  time.Minute,
+}
+
+// Option configures a client returned by NewClient.
+type Option func(*config)
+
+type config struct {
+	endpoint    string
+	urlPath     string
+	insecure    bool
+	tlsConfig   *tls.Config
+	headers     map[string]string
+	encoding    Encoding
+	compression Compression
+	retry       RetrySettings
+	timeout     time.Duration
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		endpoint: DefaultEndpoint,
+		urlPath:  DefaultMetricsPath,
+		retry:    DefaultRetrySettings,
+		timeout:  DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithEndpoint sets the host:port of the collector.
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *config) {
+		cfg.endpoint = endpoint
+	}
+}
+
+// WithURLPath overrides DefaultMetricsPath.
+func WithURLPath(urlPath string) Option {
+	return func(cfg *config) {
+		cfg.urlPath = urlPath
+	}
+}
+
+// WithInsecure sends requests over plain HTTP instead of HTTPS.
+func WithInsecure() Option {
+	return func(cfg *config) {
+		cfg.insecure = true
+	}
+}
+
+// WithTLSClientConfig sets the TLS configuration used for HTTPS.
+func WithTLSClientConfig(tlsCfg *tls.Config) Option {
+	return func(cfg *config) {
+		cfg.tlsConfig = tlsCfg.Clone()
+	}
+}
+
+// WithHeaders adds headers to every request.
+func WithHeaders(headers map[string]string) Option {
+	return func(cfg *config) {
+		cfg.headers = headers
+	}
+}
+
+// WithEncoding sets the body encoding. The default is ProtobufEncoding.
+func WithEncoding(e Encoding) Option {
+	return func(cfg *config) {
+		cfg.encoding = e
+	}
+}
+
+// WithCompression sets the body compression. The default is
+// NoCompression.
+func WithCompression(c Compression) Option {
+	return func(cfg *config) {
+		cfg.compression = c
+	}
+}
+
+// WithRetry overrides DefaultRetrySettings.
+func WithRetry(rs RetrySettings) Option {
+	return func(cfg *config) {
+		cfg.retry = rs
+	}
+}
+
+// WithTimeout overrides DefaultTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
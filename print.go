@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/capture"
+	"github.com/tyrone-anz/export-otlp-googlecloud/printer"
+)
+
+// runPrint renders every request in the given capture files in the
+// collector logging exporter layout.
+func runPrint(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("print", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s print capture...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no capture files given")
+	}
+
+	for _, name := range fs.Args() {
+		reqs, err := capture.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for i, req := range reqs {
+			fmt.Printf("# %s:%d\n", name, i)
+			if err := printer.Fprint(os.Stdout, req.GetResourceMetrics()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
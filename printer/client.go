@@ -0,0 +1,42 @@
+package printer
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+type client struct {
+	client otlpmetric.Client
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewClient wraps client so that every upload is written to w with Fprint
+// before it is handed on.
+func NewClient(c otlpmetric.Client, w io.Writer) otlpmetric.Client {
+	return &client{client: c, w: w}
+}
+
+// Start starts the wrapped client.
+func (c *client) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *client) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics prints protoMetrics and uploads them with the wrapped
+// client. A failure to print does not stop the upload.
+func (c *client) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	c.mu.Lock()
+	_ = Fprint(c.w, protoMetrics)
+	c.mu.Unlock()
+	return c.client.UploadMetrics(ctx, protoMetrics)
+}
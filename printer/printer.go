@@ -0,0 +1,237 @@
+// Package printer renders metrics in the layout of the collector's logging
+// exporter, so SDK output can be compared line by line with what the
+// collector logs.
+package printer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/internal/otlptext"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Fprint writes rms to w. Each ResourceMetrics starts with a
+// "ResourceMetrics #n" line, as the logging exporter's log entries do.
+// Trailing spaces are trimmed from every line.
+func Fprint(w io.Writer, rms []*metricpb.ResourceMetrics) error {
+	p := &printer{w: bufio.NewWriter(w)}
+	for i, rm := range rms {
+		p.resourceMetrics(i, rm)
+	}
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+// Sprint returns what Fprint would write.
+func Sprint(rms []*metricpb.ResourceMetrics) string {
+	var sb strings.Builder
+	_ = Fprint(&sb, rms)
+	return sb.String()
+}
+
+type printer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *printer) line(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	s := strings.TrimRight(fmt.Sprintf(format, args...), " ")
+	_, p.err = p.w.WriteString(s + "\n")
+}
+
+func (p *printer) resourceMetrics(i int, rm *metricpb.ResourceMetrics) {
+	p.line("ResourceMetrics #%d", i)
+	p.resource(rm.GetResource())
+	for j, ilm := range rm.GetInstrumentationLibraryMetrics() {
+		p.line("InstrumentationLibraryMetrics #%d", j)
+		lib := ilm.GetInstrumentationLibrary()
+		p.line("InstrumentationLibrary %s %s", lib.GetName(), lib.GetVersion())
+		for k, m := range ilm.GetMetrics() {
+			p.line("Metric #%d", k)
+			p.metric(m)
+		}
+	}
+}
+
+func (p *printer) resource(r *resourcepb.Resource) {
+	p.line("Resource labels:")
+	if len(r.GetAttributes()) == 0 {
+		p.line("    -> <empty>")
+		return
+	}
+	p.attributes(r.GetAttributes())
+}
+
+func (p *printer) attributes(attrs []*commonpb.KeyValue) {
+	for _, kv := range attrs {
+		p.line("    -> %s: %s(%s)", kv.GetKey(), valueType(kv.GetValue()), otlptext.Value(kv.GetValue()))
+	}
+}
+
+func (p *printer) pointAttributes(attrs []*commonpb.KeyValue) {
+	if len(attrs) == 0 {
+		return
+	}
+	p.line("Data point attributes:")
+	p.attributes(attrs)
+}
+
+func (p *printer) pointLabels(labels []*commonpb.StringKeyValue) {
+	if len(labels) == 0 {
+		return
+	}
+	p.line("Data point labels:")
+	for _, kv := range labels {
+		p.line("    -> %s: %s", kv.GetKey(), kv.GetValue())
+	}
+}
+
+func (p *printer) times(start, end uint64) {
+	p.line("StartTimestamp: %s", timestamp(start))
+	p.line("Timestamp: %s", timestamp(end))
+}
+
+func (p *printer) metric(m *metricpb.Metric) {
+	p.line("Descriptor:")
+	p.line("    -> Name: %s", m.GetName())
+	p.line("    -> Description: %s", m.GetDescription())
+	p.line("    -> Unit: %s", m.GetUnit())
+
+	switch data := m.GetData().(type) {
+	case *metricpb.Metric_Gauge:
+		p.line("    -> DataType: Gauge")
+		p.numberPoints(data.Gauge.GetDataPoints())
+	case *metricpb.Metric_Sum:
+		p.line("    -> DataType: Sum")
+		p.line("    -> IsMonotonic: %t", data.Sum.GetIsMonotonic())
+		p.line("    -> AggregationTemporality: %s", data.Sum.GetAggregationTemporality())
+		p.numberPoints(data.Sum.GetDataPoints())
+	case *metricpb.Metric_Histogram:
+		p.line("    -> DataType: Histogram")
+		p.line("    -> AggregationTemporality: %s", data.Histogram.GetAggregationTemporality())
+		p.histogramPoints(data.Histogram.GetDataPoints())
+	case *metricpb.Metric_Summary:
+		p.line("    -> DataType: Summary")
+		p.summaryPoints(data.Summary.GetDataPoints())
+	case *metricpb.Metric_IntGauge:
+		p.line("    -> DataType: IntGauge")
+		p.intPoints(data.IntGauge.GetDataPoints())
+	case *metricpb.Metric_IntSum:
+		p.line("    -> DataType: IntSum")
+		p.line("    -> IsMonotonic: %t", data.IntSum.GetIsMonotonic())
+		p.line("    -> AggregationTemporality: %s", data.IntSum.GetAggregationTemporality())
+		p.intPoints(data.IntSum.GetDataPoints())
+	case *metricpb.Metric_IntHistogram:
+		p.line("    -> DataType: IntHistogram")
+		p.line("    -> AggregationTemporality: %s", data.IntHistogram.GetAggregationTemporality())
+		p.intHistogramPoints(data.IntHistogram.GetDataPoints())
+	default:
+		p.line("    -> DataType: None")
+	}
+}
+
+func (p *printer) numberPoints(pts []*metricpb.NumberDataPoint) {
+	for i, pt := range pts {
+		p.line("NumberDataPoints #%d", i)
+		p.pointAttributes(pt.GetAttributes())
+		p.pointLabels(pt.GetLabels())
+		p.times(pt.GetStartTimeUnixNano(), pt.GetTimeUnixNano())
+		switch v := pt.GetValue().(type) {
+		case *metricpb.NumberDataPoint_AsInt:
+			p.line("Value: %d", v.AsInt)
+		case *metricpb.NumberDataPoint_AsDouble:
+			p.line("Value: %f", v.AsDouble)
+		}
+	}
+}
+
+func (p *printer) histogramPoints(pts []*metricpb.HistogramDataPoint) {
+	for i, pt := range pts {
+		p.line("HistogramDataPoints #%d", i)
+		p.pointAttributes(pt.GetAttributes())
+		p.pointLabels(pt.GetLabels())
+		p.times(pt.GetStartTimeUnixNano(), pt.GetTimeUnixNano())
+		p.line("Count: %d", pt.GetCount())
+		p.line("Sum: %f", pt.GetSum())
+		p.buckets(pt.GetExplicitBounds(), pt.GetBucketCounts())
+	}
+}
+
+func (p *printer) summaryPoints(pts []*metricpb.SummaryDataPoint) {
+	for i, pt := range pts {
+		p.line("SummaryDataPoints #%d", i)
+		p.pointAttributes(pt.GetAttributes())
+		p.pointLabels(pt.GetLabels())
+		p.times(pt.GetStartTimeUnixNano(), pt.GetTimeUnixNano())
+		p.line("Count: %d", pt.GetCount())
+		p.line("Sum: %f", pt.GetSum())
+		for j, q := range pt.GetQuantileValues() {
+			p.line("QuantileValue #%d: Quantile %f, Value %f", j, q.GetQuantile(), q.GetValue())
+		}
+	}
+}
+
+func (p *printer) intPoints(pts []*metricpb.IntDataPoint) {
+	for i, pt := range pts {
+		p.line("IntDataPoints #%d", i)
+		p.pointLabels(pt.GetLabels())
+		p.times(pt.GetStartTimeUnixNano(), pt.GetTimeUnixNano())
+		p.line("Value: %d", pt.GetValue())
+	}
+}
+
+func (p *printer) intHistogramPoints(pts []*metricpb.IntHistogramDataPoint) {
+	for i, pt := range pts {
+		p.line("IntHistogramDataPoints #%d", i)
+		p.pointLabels(pt.GetLabels())
+		p.times(pt.GetStartTimeUnixNano(), pt.GetTimeUnixNano())
+		p.line("Count: %d", pt.GetCount())
+		p.line("Sum: %d", pt.GetSum())
+		p.buckets(pt.GetExplicitBounds(), pt.GetBucketCounts())
+	}
+}
+
+func (p *printer) buckets(bounds []float64, counts []uint64) {
+	for i, b := range bounds {
+		p.line("ExplicitBounds #%d: %f", i, b)
+	}
+	for i, c := range counts {
+		p.line("Buckets #%d, Count: %d", i, c)
+	}
+}
+
+// timestamp formats t as the collector's pdata.Timestamp does.
+func timestamp(t uint64) string {
+	return time.Unix(0, int64(t)).UTC().String()
+}
+
+func valueType(v *commonpb.AnyValue) string {
+	switch v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return "STRING"
+	case *commonpb.AnyValue_BoolValue:
+		return "BOOL"
+	case *commonpb.AnyValue_IntValue:
+		return "INT"
+	case *commonpb.AnyValue_DoubleValue:
+		return "DOUBLE"
+	case *commonpb.AnyValue_ArrayValue:
+		return "ARRAY"
+	case *commonpb.AnyValue_KvlistValue:
+		return "MAP"
+	case *commonpb.AnyValue_BytesValue:
+		return "BYTES"
+	}
+	return "NULL"
+}
@@ -0,0 +1,159 @@
+package printer
+
+import (
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+// payload is m as the SDK of main.go exported it. The collector of
+// main.go read no data point attributes, so its log shows none.
+func payload(m *metricpb.Metric) []*metricpb.ResourceMetrics {
+	m.Name = "test.dummy.one"
+	return []*metricpb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttr("service.name", "unknown_service:___go_build_main_go"),
+			stringAttr("telemetry.sdk.language", "go"),
+			stringAttr("telemetry.sdk.name", "opentelemetry"),
+			stringAttr("telemetry.sdk.version", "1.0.0-RC1"),
+		}},
+		InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricpb.Metric{m},
+		}},
+	}}
+}
+
+const header = `ResourceMetrics #0
+Resource labels:
+    -> service.name: STRING(unknown_service:___go_build_main_go)
+    -> telemetry.sdk.language: STRING(go)
+    -> telemetry.sdk.name: STRING(opentelemetry)
+    -> telemetry.sdk.version: STRING(1.0.0-RC1)
+InstrumentationLibraryMetrics #0
+InstrumentationLibrary
+Metric #0
+Descriptor:
+    -> Name: test.dummy.one
+    -> Description:
+    -> Unit:
+`
+
+// The logging exporter output quoted in main.go.
+func TestFprintCollectorLog(t *testing.T) {
+	const (
+		start1, end1 = 1629948787743980000, 1629948789746479000
+		start2, end2 = 1629948055876357000, 1629948057878361000
+	)
+	summaryPoint := func(v float64) *metricpb.SummaryDataPoint {
+		return &metricpb.SummaryDataPoint{
+			StartTimeUnixNano: start1,
+			TimeUnixNano:      end1,
+			Count:             1,
+			Sum:               v,
+			QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{
+				{Quantile: 0, Value: v},
+				{Quantile: 1, Value: v},
+			},
+		}
+	}
+	gaugePoint := func(v int64) *metricpb.NumberDataPoint {
+		return &metricpb.NumberDataPoint{
+			StartTimeUnixNano: start2,
+			TimeUnixNano:      end2,
+			Value:             &metricpb.NumberDataPoint_AsInt{AsInt: v},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		payload []*metricpb.ResourceMetrics
+		want    string
+	}{
+		{
+			name: "case1",
+			payload: payload(&metricpb.Metric{Data: &metricpb.Metric_Summary{Summary: &metricpb.Summary{
+				DataPoints: []*metricpb.SummaryDataPoint{summaryPoint(100), summaryPoint(20)},
+			}}}),
+			want: header + `    -> DataType: Summary
+SummaryDataPoints #0
+StartTimestamp: 2021-08-26 03:33:07.74398 +0000 UTC
+Timestamp: 2021-08-26 03:33:09.746479 +0000 UTC
+Count: 1
+Sum: 100.000000
+QuantileValue #0: Quantile 0.000000, Value 100.000000
+QuantileValue #1: Quantile 1.000000, Value 100.000000
+SummaryDataPoints #1
+StartTimestamp: 2021-08-26 03:33:07.74398 +0000 UTC
+Timestamp: 2021-08-26 03:33:09.746479 +0000 UTC
+Count: 1
+Sum: 20.000000
+QuantileValue #0: Quantile 0.000000, Value 20.000000
+QuantileValue #1: Quantile 1.000000, Value 20.000000
+`,
+		},
+		{
+			name: "case2",
+			payload: payload(&metricpb.Metric{Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+				DataPoints: []*metricpb.NumberDataPoint{gaugePoint(100), gaugePoint(20)},
+			}}}),
+			want: header + `    -> DataType: Gauge
+NumberDataPoints #0
+StartTimestamp: 2021-08-26 03:20:55.876357 +0000 UTC
+Timestamp: 2021-08-26 03:20:57.878361 +0000 UTC
+Value: 100
+NumberDataPoints #1
+StartTimestamp: 2021-08-26 03:20:55.876357 +0000 UTC
+Timestamp: 2021-08-26 03:20:57.878361 +0000 UTC
+Value: 20
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Sprint(tc.payload); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFprintPointAttributes(t *testing.T) {
+	rms := payload(&metricpb.Metric{Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+		AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		DataPoints: []*metricpb.HistogramDataPoint{{
+			Attributes: []*commonpb.KeyValue{
+				stringAttr("rpc.method", "Hello"),
+				{Key: "retry", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+			},
+			Labels:         []*commonpb.StringKeyValue{{Key: "rpc.method", Value: "Hello"}},
+			Count:          1,
+			Sum:            2.5,
+			ExplicitBounds: []float64{5},
+			BucketCounts:   []uint64{1, 0},
+		}},
+	}}})
+	want := header + `    -> DataType: Histogram
+    -> AggregationTemporality: AGGREGATION_TEMPORALITY_DELTA
+HistogramDataPoints #0
+Data point attributes:
+    -> rpc.method: STRING(Hello)
+    -> retry: BOOL(true)
+Data point labels:
+    -> rpc.method: Hello
+StartTimestamp: 1970-01-01 00:00:00 +0000 UTC
+Timestamp: 1970-01-01 00:00:00 +0000 UTC
+Count: 1
+Sum: 2.500000
+ExplicitBounds #0: 5.000000
+Buckets #0, Count: 1
+Buckets #1, Count: 0
+`
+	if got := Sprint(rms); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package receiver
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ServeHTTP implements the OTLP/HTTP metrics endpoint. It accepts
+// application/x-protobuf and application/json bodies, optionally gzip
+// encoded, and answers in the encoding of the request. Request headers are
+// recorded as metadata with lower-cased keys, as gRPC would.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var (
+		unmarshal func([]byte, proto.Message) error
+		marshal   func(proto.Message) ([]byte, error)
+	)
+	switch contentType {
+	case "application/x-protobuf":
+		unmarshal, marshal = proto.Unmarshal, proto.Marshal
+	case "application/json":
+		unmarshal, marshal = protojson.Unmarshal, protojson.Marshal
+	default:
+		http.Error(w, "unsupported content type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			writeStatus(w, marshal, contentType, http.StatusBadRequest, err)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		writeStatus(w, marshal, contentType, http.StatusBadRequest, err)
+		return
+	}
+	var payload colmetricpb.ExportMetricsServiceRequest
+	if err := unmarshal(b, &payload); err != nil {
+		writeStatus(w, marshal, contentType, http.StatusBadRequest, err)
+		return
+	}
+
+	md := metadata.MD{}
+	for k, vs := range req.Header {
+		md.Append(k, vs...)
+	}
+	r.record(md, &payload)
+	if r.reject != nil {
+		if err := r.reject(payload.GetResourceMetrics()); err != nil {
+			code := http.StatusInternalServerError
+			if rejection(err).Code() == codes.InvalidArgument {
+				code = http.StatusBadRequest
+			}
+			writeStatus(w, marshal, contentType, code, err)
+			return
+		}
+	}
+
+	resp, err := marshal(&colmetricpb.ExportMetricsServiceResponse{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(resp)
+}
+
+// writeStatus answers with a google.rpc.Status body, as the collector
+// does for rejected requests. The code of a gRPC status error is kept;
+// other errors are reported as InvalidArgument.
+func writeStatus(w http.ResponseWriter, marshal func(proto.Message) ([]byte, error), contentType string, code int, err error) {
+	st := rejection(err).Proto()
+	b, merr := marshal(st)
+	if merr != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,239 @@
+// Package receiver provides an in-process OTLP metrics receiver that
+// stands in for the collector and captures every request it is sent over
+// gRPC or HTTP.
+package receiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed requests
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// metricsPath is the OTLP/HTTP metrics path served by StartHTTP.
+const metricsPath = "/v1/metrics"
+
+var errAlreadyStarted = errors.New("receiver already started")
+
+// Request is a single ExportMetricsServiceRequest captured by the Receiver.
+type Request struct {
+	Received time.Time
+	Metadata metadata.MD
+	Payload  *colmetricpb.ExportMetricsServiceRequest
+}
+
+// Receiver implements the OTLP MetricsService on a local listener.
+type Receiver struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []Request
+	server   *grpc.Server
+	listener net.Listener
+	served   chan struct{}
+
+	httpServer   *http.Server
+	httpListener net.Listener
+	httpServed   chan struct{}
+
+	reject func([]*metricpb.ResourceMetrics) error
+}
+
+// Option configures a Receiver.
+type Option func(*Receiver)
+
+// WithRejector makes the receiver answer each request with the error fn
+// returns for its payload, if any, instead of acknowledging it. A gRPC
+// status error keeps its code; any other error is reported as
+// InvalidArgument. Rejected requests are still captured.
+func WithRejector(fn func([]*metricpb.ResourceMetrics) error) Option {
+	return func(r *Receiver) {
+		r.reject = fn
+	}
+}
+
+// New constructs a Receiver. Call Start to begin accepting requests.
+func New(opts ...Option) *Receiver {
+	r := &Receiver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start listens on addr and serves the MetricsService in the background.
+// An empty addr picks an ephemeral port on the loopback interface.
+func (r *Receiver) Start(addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.server != nil {
+		return errAlreadyStarted
+	}
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	r.listener = lis
+	r.server = grpc.NewServer()
+	r.served = make(chan struct{})
+	colmetricpb.RegisterMetricsServiceServer(r.server, r)
+
+	go func(srv *grpc.Server, done chan struct{}) {
+		defer close(done)
+		_ = srv.Serve(lis)
+	}(r.server, r.served)
+	return nil
+}
+
+// Endpoint returns the host:port the Receiver is listening on, suitable
+// for otlpmetricgrpc.WithEndpoint. It is empty until Start succeeds.
+func (r *Receiver) Endpoint() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.listener == nil {
+		return ""
+	}
+	return r.listener.Addr().String()
+}
+
+// StartHTTP listens on addr and serves OTLP/HTTP on /v1/metrics in the
+// background. An empty addr picks an ephemeral port on the loopback
+// interface. Requests from both transports are captured together.
+func (r *Receiver) StartHTTP(addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.httpServer != nil {
+		return errAlreadyStarted
+	}
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, r)
+	r.httpListener = lis
+	r.httpServer = &http.Server{Handler: mux}
+	r.httpServed = make(chan struct{})
+
+	go func(srv *http.Server, done chan struct{}) {
+		defer close(done)
+		_ = srv.Serve(lis)
+	}(r.httpServer, r.httpServed)
+	return nil
+}
+
+// HTTPEndpoint returns the host:port of the OTLP/HTTP listener, suitable
+// for otlphttp.WithEndpoint. It is empty until StartHTTP succeeds.
+func (r *Receiver) HTTPEndpoint() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.httpListener == nil {
+		return ""
+	}
+	return r.httpListener.Addr().String()
+}
+
+// Stop gracefully stops both servers and waits for them to return.
+func (r *Receiver) Stop() {
+	r.mu.Lock()
+	srv, done := r.server, r.served
+	httpSrv, httpDone := r.httpServer, r.httpServed
+	r.server, r.listener, r.served = nil, nil, nil
+	r.httpServer, r.httpListener, r.httpServed = nil, nil, nil
+	r.mu.Unlock()
+
+	if srv != nil {
+		srv.GracefulStop()
+		<-done
+	}
+	if httpSrv != nil {
+		_ = httpSrv.Shutdown(context.Background())
+		<-httpDone
+	}
+}
+
+// Export records the request and acknowledges or rejects it.
+func (r *Receiver) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.record(md, req)
+	if r.reject != nil {
+		if err := r.reject(req.GetResourceMetrics()); err != nil {
+			return nil, rejection(err).Err()
+		}
+	}
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+// rejection returns the status a request is answered with when it is
+// rejected or malformed: that of a gRPC status error, or InvalidArgument.
+func rejection(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	return status.New(codes.InvalidArgument, err.Error())
+}
+
+func (r *Receiver) record(md metadata.MD, req *colmetricpb.ExportMetricsServiceRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, Request{
+		Received: time.Now(),
+		Metadata: md.Copy(),
+		Payload:  proto.Clone(req).(*colmetricpb.ExportMetricsServiceRequest),
+	})
+}
+
+// Requests returns the requests captured so far, in arrival order.
+func (r *Receiver) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Request, len(r.requests))
+	copy(out, r.requests)
+	return out
+}
+
+// ResourceMetrics returns the ResourceMetrics of every captured request,
+// flattened in arrival order.
+func (r *Receiver) ResourceMetrics() []*metricpb.ResourceMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rms []*metricpb.ResourceMetrics
+	for _, req := range r.requests {
+		rms = append(rms, req.Payload.GetResourceMetrics()...)
+	}
+	return rms
+}
+
+// Reset discards all captured requests.
+func (r *Receiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = nil
+}
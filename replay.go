@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/capture"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/grpc/status"
+)
+
+// headerFlag collects repeated -header key=value flags.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	parts := make([]string, 0, len(h))
+	for k, v := range h {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (h headerFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("header %q is not key=value", s)
+	}
+	h[kv[0]] = kv[1]
+	return nil
+}
+
+// replayed is a captured request and where it came from.
+type replayed struct {
+	source string
+	req    *colmetricpb.ExportMetricsServiceRequest
+}
+
+// runReplay re-sends captured requests, in file order, through the gRPC
+// client and prints the status of each.
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	endpoint := fs.String("endpoint", "localhost:55680", "OTLP/gRPC collector endpoint")
+	insecure := fs.Bool("insecure", true, "disable client transport security")
+	headers := headerFlag{}
+	fs.Var(headers, "header", "header to send as key=value; may be repeated")
+	compressor := fs.String("compressor", "", "gRPC compressor, e.g. gzip")
+	retry := fs.Bool("retry", false, "retry transient failures with exponential back-off")
+	retryInitial := fs.Duration("retry-initial", 5*time.Second, "first retry back-off")
+	retryMax := fs.Duration("retry-max-interval", 30*time.Second, "largest retry back-off")
+	retryElapsed := fs.Duration("retry-max-elapsed", time.Minute, "give up retrying a request after this long")
+	rebase := fs.Bool("rebase", false, "shift timestamps so the latest point in the captures is now")
+	rate := fs.Float64("rate", 0, "maximum requests per second; 0 sends as fast as possible")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s replay [flags] capture...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no capture files given")
+	}
+
+	var all []replayed
+	var reqs []*colmetricpb.ExportMetricsServiceRequest
+	for _, name := range fs.Args() {
+		fileReqs, err := capture.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for i, req := range fileReqs {
+			all = append(all, replayed{source: fmt.Sprintf("%s:%d", name, i), req: req})
+		}
+		reqs = append(reqs, fileReqs...)
+	}
+	if *rebase {
+		if latest := capture.Latest(reqs); latest != 0 {
+			capture.Shift(reqs, time.Now().UnixNano()-int64(latest))
+		}
+	}
+
+	clientOpts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(*endpoint),
+		otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetrySettings{
+			Enabled:         *retry,
+			InitialInterval: *retryInitial,
+			MaxInterval:     *retryMax,
+			MaxElapsedTime:  *retryElapsed,
+		}),
+	}
+	if *insecure {
+		clientOpts = append(clientOpts, otlpmetricgrpc.WithInsecure())
+	}
+	if len(headers) > 0 {
+		clientOpts = append(clientOpts, otlpmetricgrpc.WithHeaders(headers))
+	}
+	if *compressor != "" {
+		clientOpts = append(clientOpts, otlpmetricgrpc.WithCompressor(*compressor))
+	}
+	client := otlpmetricgrpc.NewClient(clientOpts...)
+	if err := client.Start(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = client.Stop(ctx) }()
+
+	var interval time.Duration
+	if *rate > 0 {
+		interval = time.Duration(float64(time.Second) / *rate)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REQUEST\tSOURCE\tCODE\tLATENCY\tMESSAGE")
+	failed := 0
+	next := time.Now()
+	for i, r := range all {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+			next = next.Add(interval)
+		}
+		start := time.Now()
+		err := client.UploadMetrics(ctx, r.req.GetResourceMetrics())
+		st := status.Convert(err)
+		if err != nil {
+			failed++
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i, r.source, st.Code(), time.Since(start).Round(time.Millisecond), st.Message())
+	}
+	_ = tw.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d requests failed", failed, len(all))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// representativeResource returns the attributes a typical deployment of
+// the named kind would report, so that the monitored resource mapping can
+// be exercised without running there. The names follow the monitored
+// resource types they map to.
+func representativeResource(name string) (*resource.Resource, error) {
+	gcp := []attribute.KeyValue{
+		semconv.CloudProviderGCP,
+		semconv.CloudAccountIDKey.String("example-project"),
+		semconv.CloudRegionKey.String("australia-southeast1"),
+		semconv.CloudAvailabilityZoneKey.String("australia-southeast1-a"),
+	}
+
+	var attrs []attribute.KeyValue
+	switch name {
+	case "gce_instance":
+		attrs = append(gcp,
+			semconv.CloudPlatformGCPComputeEngine,
+			semconv.HostIDKey.String("4520031799277581759"),
+			semconv.HostNameKey.String("harness-1"),
+		)
+	case "k8s_container":
+		attrs = append(gcp,
+			semconv.CloudPlatformGCPKubernetesEngine,
+			semconv.K8SClusterNameKey.String("harness-cluster"),
+			semconv.K8SNamespaceNameKey.String("default"),
+			semconv.K8SPodNameKey.String("harness-7d4b9c8f6d-x2x9z"),
+			semconv.K8SContainerNameKey.String("harness"),
+		)
+	case "generic_task":
+		attrs = []attribute.KeyValue{
+			semconv.CloudRegionKey.String("australia-southeast1"),
+			semconv.ServiceNamespaceKey.String("harness"),
+			semconv.ServiceInstanceIDKey.String("instance-1"),
+		}
+	case "generic_node":
+		attrs = []attribute.KeyValue{
+			semconv.CloudRegionKey.String("australia-southeast1"),
+			semconv.ServiceNamespaceKey.String("harness"),
+			semconv.HostNameKey.String("harness-1"),
+		}
+	default:
+		return nil, fmt.Errorf("unknown resource %q", name)
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), nil
+}
@@ -0,0 +1,116 @@
+package rules
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/exact"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/lastvalue"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/minmaxsumcount"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/sum"
+)
+
+// AggregatorRule assigns an aggregator to the instruments it matches.
+type AggregatorRule struct {
+	Match
+	// Aggregator is one of sum, lastvalue, minmaxsumcount, histogram or
+	// exact.
+	Aggregator string `json:"aggregator"`
+	// Boundaries are the explicit histogram boundaries. They are only
+	// valid with the histogram aggregator; when empty the SDK defaults
+	// are used.
+	Boundaries []float64 `json:"boundaries,omitempty"`
+}
+
+type aggregatorRule struct {
+	matcher
+	newAggs func(desc *metric.Descriptor, aggPtrs []*export.Aggregator)
+}
+
+// AggregatorSelector is an export.AggregatorSelector that applies the
+// first matching rule, and the fallback selector when none matches.
+type AggregatorSelector struct {
+	rules    []aggregatorRule
+	fallback export.AggregatorSelector
+}
+
+var _ export.AggregatorSelector = (*AggregatorSelector)(nil)
+
+// NewAggregatorSelector compiles rules into an AggregatorSelector.
+func NewAggregatorSelector(rules []AggregatorRule, fallback export.AggregatorSelector) (*AggregatorSelector, error) {
+	s := &AggregatorSelector{fallback: fallback}
+	for i, r := range rules {
+		m, err := r.Match.compile()
+		if err != nil {
+			return nil, fmt.Errorf("aggregator rule %d: %w", i, err)
+		}
+		newAggs, err := aggregatorConstructor(r)
+		if err != nil {
+			return nil, fmt.Errorf("aggregator rule %d: %w", i, err)
+		}
+		s.rules = append(s.rules, aggregatorRule{matcher: m, newAggs: newAggs})
+	}
+	return s, nil
+}
+
+// AggregatorFor implements export.AggregatorSelector.
+func (s *AggregatorSelector) AggregatorFor(descriptor *metric.Descriptor, aggPtrs ...*export.Aggregator) {
+	for _, r := range s.rules {
+		if r.matches(descriptor) {
+			r.newAggs(descriptor, aggPtrs)
+			return
+		}
+	}
+	s.fallback.AggregatorFor(descriptor, aggPtrs...)
+}
+
+func aggregatorConstructor(r AggregatorRule) (func(*metric.Descriptor, []*export.Aggregator), error) {
+	if len(r.Boundaries) > 0 && r.Aggregator != "histogram" {
+		return nil, fmt.Errorf("boundaries are only valid with the histogram aggregator, not %q", r.Aggregator)
+	}
+
+	switch r.Aggregator {
+	case "sum":
+		return func(_ *metric.Descriptor, aggPtrs []*export.Aggregator) {
+			aggs := sum.New(len(aggPtrs))
+			for i := range aggPtrs {
+				*aggPtrs[i] = &aggs[i]
+			}
+		}, nil
+	case "lastvalue":
+		return func(_ *metric.Descriptor, aggPtrs []*export.Aggregator) {
+			aggs := lastvalue.New(len(aggPtrs))
+			for i := range aggPtrs {
+				*aggPtrs[i] = &aggs[i]
+			}
+		}, nil
+	case "minmaxsumcount":
+		return func(desc *metric.Descriptor, aggPtrs []*export.Aggregator) {
+			aggs := minmaxsumcount.New(len(aggPtrs), desc)
+			for i := range aggPtrs {
+				*aggPtrs[i] = &aggs[i]
+			}
+		}, nil
+	case "histogram":
+		var opts []histogram.Option
+		if len(r.Boundaries) > 0 {
+			opts = append(opts, histogram.WithExplicitBoundaries(r.Boundaries))
+		}
+		return func(desc *metric.Descriptor, aggPtrs []*export.Aggregator) {
+			aggs := histogram.New(len(aggPtrs), desc, opts...)
+			for i := range aggPtrs {
+				*aggPtrs[i] = &aggs[i]
+			}
+		}, nil
+	case "exact":
+		return func(_ *metric.Descriptor, aggPtrs []*export.Aggregator) {
+			aggs := exact.New(len(aggPtrs))
+			for i := range aggPtrs {
+				*aggPtrs[i] = &aggs[i]
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown aggregator %q", r.Aggregator)
+}
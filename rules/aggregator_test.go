@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/number"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+)
+
+func aggregatorFor(s export.AggregatorSelector, name string, kind metric.InstrumentKind) export.Aggregator {
+	desc := metric.NewDescriptor(name, kind, number.Float64Kind)
+	var agg export.Aggregator
+	s.AggregatorFor(&desc, &agg)
+	return agg
+}
+
+func TestAggregatorSelector(t *testing.T) {
+	s, err := NewAggregatorSelector([]AggregatorRule{
+		{Match: Match{Name: "rpc.*.latency"}, Aggregator: "histogram", Boundaries: []float64{5, 10}},
+		// Shadowed by the rule above for rpc.*.latency.
+		{Match: Match{Name: "*.latency"}, Aggregator: "exact"},
+		{Match: Match{Regex: `^queue\.(depth|size)$`, InstrumentKinds: []string{"ValueRecorder"}}, Aggregator: "lastvalue"},
+		{Match: Match{InstrumentKinds: []string{"UpDownCounterInstrumentKind"}}, Aggregator: "minmaxsumcount"},
+	}, selector.NewWithInexpensiveDistribution())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		kind metric.InstrumentKind
+		want aggregation.Kind
+	}{
+		{name: "rpc.server.latency", kind: metric.ValueRecorderInstrumentKind, want: aggregation.HistogramKind},
+		{name: "db.latency", kind: metric.ValueRecorderInstrumentKind, want: aggregation.ExactKind},
+		// The glob does not cross dots the way a regex would.
+		{name: "rpc.latency", kind: metric.ValueRecorderInstrumentKind, want: aggregation.ExactKind},
+		{name: "queue.depth", kind: metric.ValueRecorderInstrumentKind, want: aggregation.LastValueKind},
+		{name: "queue.depth", kind: metric.CounterInstrumentKind, want: aggregation.SumKind},
+		{name: "queue.depths", kind: metric.ValueRecorderInstrumentKind, want: aggregation.MinMaxSumCountKind},
+		{name: "in.flight", kind: metric.UpDownCounterInstrumentKind, want: aggregation.MinMaxSumCountKind},
+		// Unmatched, so the fallback decides.
+		{name: "requests", kind: metric.CounterInstrumentKind, want: aggregation.SumKind},
+	} {
+		agg := aggregatorFor(s, tc.name, tc.kind)
+		if got := agg.Aggregation().Kind(); got != tc.want {
+			t.Errorf("%s (%s): got %s, want %s", tc.name, tc.kind, got, tc.want)
+		}
+	}
+
+	hist, ok := aggregatorFor(s, "rpc.client.latency", metric.ValueRecorderInstrumentKind).Aggregation().(aggregation.Histogram)
+	if !ok {
+		t.Fatal("rpc.client.latency is not a histogram")
+	}
+	buckets, err := hist.Histogram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{5, 10}; !reflect.DeepEqual(buckets.Boundaries, want) {
+		t.Errorf("got boundaries %v, want %v", buckets.Boundaries, want)
+	}
+}
+
+func TestNewAggregatorSelectorErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rule AggregatorRule
+		want string
+	}{
+		{
+			name: "boundaries without histogram",
+			rule: AggregatorRule{Aggregator: "sum", Boundaries: []float64{1}},
+			want: `aggregator rule 1: boundaries are only valid with the histogram aggregator, not "sum"`,
+		},
+		{
+			name: "unknown aggregator",
+			rule: AggregatorRule{Aggregator: "ddsketch"},
+			want: `aggregator rule 1: unknown aggregator "ddsketch"`,
+		},
+		{
+			name: "bad glob",
+			rule: AggregatorRule{Match: Match{Name: "[a"}, Aggregator: "sum"},
+			want: `aggregator rule 1: name "[a": syntax error in pattern`,
+		},
+		{
+			name: "bad regex",
+			rule: AggregatorRule{Match: Match{Regex: "("}, Aggregator: "sum"},
+			want: `aggregator rule 1: regex "(": `,
+		},
+		{
+			name: "unknown instrument kind",
+			rule: AggregatorRule{Match: Match{InstrumentKinds: []string{"Gauge"}}, Aggregator: "sum"},
+			want: `aggregator rule 1: unknown instrument kind "Gauge"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := []AggregatorRule{{Aggregator: "sum"}, tc.rule}
+			_, err := NewAggregatorSelector(rules, selector.NewWithInexpensiveDistribution())
+			if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("got %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+)
+
+// ExportKindRule assigns a temporality to the instruments it matches.
+type ExportKindRule struct {
+	Match
+	// AggregationKinds restricts the rule to the listed aggregations,
+	// for example "Sum" or "Histogram".
+	AggregationKinds []string `json:"aggregation_kinds,omitempty"`
+	// ExportKind is either cumulative or delta.
+	ExportKind string `json:"export_kind"`
+}
+
+type exportKindRule struct {
+	matcher
+	aggKinds map[aggregation.Kind]bool
+	kind     export.ExportKind
+	index    int
+}
+
+// ExportKindSelector is an export.ExportKindSelector that applies the
+// first matching rule, and the fallback selector when none matches.
+type ExportKindSelector struct {
+	rules    []exportKindRule
+	fallback export.ExportKindSelector
+}
+
+var _ export.ExportKindSelector = (*ExportKindSelector)(nil)
+
+var aggregationKinds = []aggregation.Kind{
+	aggregation.SumKind,
+	aggregation.MinMaxSumCountKind,
+	aggregation.HistogramKind,
+	aggregation.LastValueKind,
+	aggregation.ExactKind,
+}
+
+func parseAggregationKind(s string) (aggregation.Kind, error) {
+	for _, k := range aggregationKinds {
+		if strings.EqualFold(s, string(k)) {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown aggregation kind %q", s)
+}
+
+func parseExportKind(s string) (export.ExportKind, error) {
+	switch strings.ToLower(s) {
+	case "cumulative":
+		return export.CumulativeExportKind, nil
+	case "delta":
+		return export.DeltaExportKind, nil
+	}
+	return 0, fmt.Errorf("unknown export kind %q", s)
+}
+
+// NewExportKindSelector compiles rules into an ExportKindSelector.
+func NewExportKindSelector(rules []ExportKindRule, fallback export.ExportKindSelector) (*ExportKindSelector, error) {
+	s := &ExportKindSelector{fallback: fallback}
+	for i, r := range rules {
+		m, err := r.Match.compile()
+		if err != nil {
+			return nil, fmt.Errorf("export kind rule %d: %w", i, err)
+		}
+		kind, err := parseExportKind(r.ExportKind)
+		if err != nil {
+			return nil, fmt.Errorf("export kind rule %d: %w", i, err)
+		}
+		c := exportKindRule{matcher: m, kind: kind, index: i}
+		if len(r.AggregationKinds) > 0 {
+			c.aggKinds = make(map[aggregation.Kind]bool)
+			for _, ak := range r.AggregationKinds {
+				k, err := parseAggregationKind(ak)
+				if err != nil {
+					return nil, fmt.Errorf("export kind rule %d: %w", i, err)
+				}
+				c.aggKinds[k] = true
+			}
+		}
+		s.rules = append(s.rules, c)
+	}
+	return s, nil
+}
+
+// ExportKindFor implements export.ExportKindSelector.
+func (s *ExportKindSelector) ExportKindFor(descriptor *metric.Descriptor, aggregatorKind aggregation.Kind) export.ExportKind {
+	for _, r := range s.rules {
+		if r.matches(descriptor) && (r.aggKinds == nil || r.aggKinds[aggregatorKind]) {
+			return r.kind
+		}
+	}
+	return s.fallback.ExportKindFor(descriptor, aggregatorKind)
+}
+
+// CheckMemory reports the rules whose export kind requires the processor
+// to keep memory (see export.ExportKind.MemoryRequired) for an instrument
+// kind they can match, when memory is false. Without memory the basic
+// processor stops exporting a series in every interval it is not
+// updated. The fallback selector is not checked.
+func (s *ExportKindSelector) CheckMemory(memory bool) error {
+	if memory {
+		return nil
+	}
+
+	var problems []string
+	for _, r := range s.rules {
+		for _, ik := range instrumentKinds {
+			if r.kinds != nil && !r.kinds[ik] {
+				continue
+			}
+			if r.kind.MemoryRequired(ik) {
+				problems = append(problems, fmt.Sprintf("rule %d (%s) with %s", r.index, r.kind, ik))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("export kinds require processor memory: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/number"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+)
+
+func TestExportKindSelector(t *testing.T) {
+	s, err := NewExportKindSelector([]ExportKindRule{
+		{Match: Match{Name: "*.latency"}, AggregationKinds: []string{"Histogram"}, ExportKind: "delta"},
+		{Match: Match{Name: "*.latency"}, ExportKind: "Cumulative"},
+		{Match: Match{InstrumentKinds: []string{"Counter"}}, ExportKind: "delta"},
+	}, export.CumulativeExportKindSelector())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		kind metric.InstrumentKind
+		agg  aggregation.Kind
+		want export.ExportKind
+	}{
+		{name: "rpc.latency", kind: metric.ValueRecorderInstrumentKind, agg: aggregation.HistogramKind, want: export.DeltaExportKind},
+		{name: "rpc.latency", kind: metric.ValueRecorderInstrumentKind, agg: aggregation.ExactKind, want: export.CumulativeExportKind},
+		// The first matching rule wins even over a later, narrower one.
+		{name: "rpc.latency", kind: metric.CounterInstrumentKind, agg: aggregation.SumKind, want: export.CumulativeExportKind},
+		{name: "requests", kind: metric.CounterInstrumentKind, agg: aggregation.SumKind, want: export.DeltaExportKind},
+		{name: "requests", kind: metric.SumObserverInstrumentKind, agg: aggregation.SumKind, want: export.CumulativeExportKind},
+	} {
+		desc := metric.NewDescriptor(tc.name, tc.kind, number.Int64Kind)
+		if got := s.ExportKindFor(&desc, tc.agg); got != tc.want {
+			t.Errorf("%s (%s, %s): got %s, want %s", tc.name, tc.kind, tc.agg, got, tc.want)
+		}
+	}
+}
+
+func TestNewExportKindSelectorErrors(t *testing.T) {
+	for _, tc := range []struct {
+		rule ExportKindRule
+		want string
+	}{
+		{rule: ExportKindRule{ExportKind: "pass-through"}, want: `export kind rule 0: unknown export kind "pass-through"`},
+		{
+			rule: ExportKindRule{AggregationKinds: []string{"Sketch"}, ExportKind: "delta"},
+			want: `export kind rule 0: unknown aggregation kind "Sketch"`,
+		},
+	} {
+		_, err := NewExportKindSelector([]ExportKindRule{tc.rule}, export.CumulativeExportKindSelector())
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("got %v, want %s", err, tc.want)
+		}
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rules []ExportKindRule
+		want  string
+	}{
+		{
+			name:  "delta counters",
+			rules: []ExportKindRule{{Match: Match{InstrumentKinds: []string{"Counter", "ValueRecorder"}}, ExportKind: "delta"}},
+		},
+		{
+			name:  "cumulative observers",
+			rules: []ExportKindRule{{Match: Match{InstrumentKinds: []string{"SumObserver"}}, ExportKind: "cumulative"}},
+		},
+		{
+			name: "cumulative counters",
+			rules: []ExportKindRule{
+				{Match: Match{InstrumentKinds: []string{"SumObserver"}}, ExportKind: "cumulative"},
+				{Match: Match{InstrumentKinds: []string{"Counter"}}, ExportKind: "cumulative"},
+			},
+			want: "export kinds require processor memory: rule 1 (CumulativeExportKind) with CounterInstrumentKind",
+		},
+		{
+			name:  "delta for every kind",
+			rules: []ExportKindRule{{ExportKind: "delta"}},
+			want: "export kinds require processor memory: " +
+				"rule 0 (DeltaExportKind) with SumObserverInstrumentKind; " +
+				"rule 0 (DeltaExportKind) with UpDownSumObserverInstrumentKind",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewExportKindSelector(tc.rules, export.CumulativeExportKindSelector())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.CheckMemory(true); err != nil {
+				t.Errorf("with memory: %v", err)
+			}
+			err = s.CheckMemory(false)
+			if got := errorString(err); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,42 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// File is the JSON document read by Load, for example:
+//
+//	{
+//	  "aggregators": [
+//	    {"name": "*.latency", "aggregator": "histogram", "boundaries": [5, 10, 25, 50]},
+//	    {"regex": "^queue\\.depth$", "instrument_kinds": ["ValueRecorder"], "aggregator": "lastvalue"}
+//	  ],
+//	  "export_kinds": [
+//	    {"instrument_kinds": ["Counter", "SumObserver"], "export_kind": "cumulative"},
+//	    {"name": "*.latency", "aggregation_kinds": ["Histogram"], "export_kind": "delta"}
+//	  ]
+//	}
+type File struct {
+	Aggregators []AggregatorRule `json:"aggregators,omitempty"`
+	ExportKinds []ExportKindRule `json:"export_kinds,omitempty"`
+}
+
+// Load reads and decodes a rules file. Unknown fields are rejected so
+// that typos do not silently fall through to the fallback selector.
+func Load(filename string) (*File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rf File
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rf); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &rf, nil
+}
@@ -0,0 +1,92 @@
+// Package rules implements SDK selectors that decide per instrument,
+// based on rules matching the instrument name and kind.
+package rules
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Match selects instruments. Every non-empty field must match; an empty
+// Match matches every instrument.
+type Match struct {
+	// Name is a glob over the instrument name, as understood by
+	// path.Match.
+	Name string `json:"name,omitempty"`
+	// Regex is a regular expression over the instrument name.
+	Regex string `json:"regex,omitempty"`
+	// InstrumentKinds restricts the match to the listed kinds, given
+	// either as "ValueRecorder" or as "ValueRecorderInstrumentKind".
+	InstrumentKinds []string `json:"instrument_kinds,omitempty"`
+}
+
+// matcher is a compiled Match.
+type matcher struct {
+	glob  string
+	regex *regexp.Regexp
+	kinds map[metric.InstrumentKind]bool
+}
+
+var instrumentKinds = []metric.InstrumentKind{
+	metric.ValueRecorderInstrumentKind,
+	metric.ValueObserverInstrumentKind,
+	metric.CounterInstrumentKind,
+	metric.UpDownCounterInstrumentKind,
+	metric.SumObserverInstrumentKind,
+	metric.UpDownSumObserverInstrumentKind,
+}
+
+func parseInstrumentKind(s string) (metric.InstrumentKind, error) {
+	for _, k := range instrumentKinds {
+		if strings.EqualFold(s, k.String()) || strings.EqualFold(s+"InstrumentKind", k.String()) {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown instrument kind %q", s)
+}
+
+func (m Match) compile() (matcher, error) {
+	c := matcher{glob: m.Name}
+	if m.Name != "" {
+		if _, err := path.Match(m.Name, ""); err != nil {
+			return c, fmt.Errorf("name %q: %w", m.Name, err)
+		}
+	}
+	if m.Regex != "" {
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return c, fmt.Errorf("regex %q: %w", m.Regex, err)
+		}
+		c.regex = re
+	}
+	if len(m.InstrumentKinds) > 0 {
+		c.kinds = make(map[metric.InstrumentKind]bool)
+		for _, s := range m.InstrumentKinds {
+			k, err := parseInstrumentKind(s)
+			if err != nil {
+				return c, err
+			}
+			c.kinds[k] = true
+		}
+	}
+	return c, nil
+}
+
+func (c matcher) matches(desc *metric.Descriptor) bool {
+	if c.glob != "" {
+		if ok, _ := path.Match(c.glob, desc.Name()); !ok {
+			return false
+		}
+	}
+	if c.regex != nil && !c.regex.MatchString(desc.Name()) {
+		return false
+	}
+	if c.kinds != nil && !c.kinds[desc.InstrumentKind()] {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/telemetry"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+)
+
+// selfTelemetry is the MeterProvider that records the harness's own
+// export path, kept apart from the one under test.
+type selfTelemetry struct {
+	cont     *controller.Controller
+	exporter *otlpmetric.Exporter
+}
+
+// startSelfTelemetry returns nil values unless -self-telemetry or
+// -self-endpoint is set. With -self-endpoint the metrics are pushed every
+// -collect-period; otherwise they are only collected for the summary at
+// shutdown.
+func (o options) startSelfTelemetry(ctx context.Context) (*selfTelemetry, *telemetry.Metrics, error) {
+	if !o.selfTelemetry && o.selfEndpoint == "" {
+		return nil, nil, nil
+	}
+
+	kinds := export.CumulativeExportKindSelector()
+	contOpts := []controller.Option{controller.WithCollectPeriod(o.collectPeriod)}
+	s := &selfTelemetry{}
+	if o.selfEndpoint != "" {
+		clientOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(o.selfEndpoint)}
+		if o.insecure {
+			clientOpts = append(clientOpts, otlpmetricgrpc.WithInsecure())
+		}
+		exporter, err := otlpmetric.New(ctx, otlpmetricgrpc.NewClient(clientOpts...), otlpmetric.WithMetricExportKindSelector(kinds))
+		if err != nil {
+			return nil, nil, err
+		}
+		s.exporter = exporter
+		contOpts = append(contOpts, controller.WithExporter(exporter))
+	}
+	s.cont = controller.New(processor.New(telemetry.Selector(), kinds), contOpts...)
+	if s.exporter != nil {
+		if err := s.cont.Start(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s, telemetry.New(s.cont.MeterProvider()), nil
+}
+
+// shutdown collects one last time, exporting if -self-endpoint is set,
+// and prints the summary.
+func (s *selfTelemetry) shutdown(ctx context.Context, timeout time.Duration) {
+	if s == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if s.cont.IsRunning() {
+		if err := s.cont.Stop(ctx); err != nil {
+			fmt.Printf("self-telemetry export failed: %v\n", err)
+		}
+		if err := s.exporter.Shutdown(ctx); err != nil {
+			fmt.Printf("self-telemetry exporter shutdown failed: %v\n", err)
+		}
+	} else if err := s.cont.Collect(ctx); err != nil {
+		fmt.Printf("self-telemetry collection failed: %v\n", err)
+		return
+	}
+
+	fmt.Println("self-telemetry:")
+	if err := telemetry.Fprint(os.Stdout, s.cont); err != nil {
+		fmt.Printf("error %v\n", err)
+	}
+}
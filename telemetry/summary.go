@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric/number"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+)
+
+// Fprint writes one line per instrument and label set of cs, which may be
+// a checkpoint set or a controller, to w, sorted by name and labels:
+//
+//	exporter.uploads.failed{code=Internal} 1
+//	exporter.upload.points count=2 min=1 max=5 sum=6
+//	exporter.upload.latency count=2 sum=3.500000 le1=1 le5=2
+//
+// Histogram buckets are cumulative and only those up to the first that
+// holds every value are shown.
+func Fprint(w io.Writer, cs interface {
+	ForEach(export.ExportKindSelector, func(export.Record) error) error
+}) error {
+	var lines []string
+	err := cs.ForEach(export.CumulativeExportKindSelector(), func(rec export.Record) error {
+		value, err := formatAggregation(rec.Aggregation(), rec.Descriptor().NumberKind())
+		if err != nil {
+			return fmt.Errorf("%s: %w", rec.Descriptor().Name(), err)
+		}
+		name := rec.Descriptor().Name()
+		if labels := rec.Labels(); labels.Len() > 0 {
+			parts := make([]string, 0, labels.Len())
+			for iter := labels.Iter(); iter.Next(); {
+				kv := iter.Label()
+				parts = append(parts, string(kv.Key)+"="+kv.Value.Emit())
+			}
+			name += "{" + strings.Join(parts, ",") + "}"
+		}
+		lines = append(lines, name+" "+value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(lines)
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatAggregation(agg aggregation.Aggregation, kind number.Kind) (string, error) {
+	switch a := agg.(type) {
+	case aggregation.Histogram:
+		count, err := a.Count()
+		if err != nil {
+			return "", err
+		}
+		sum, err := a.Sum()
+		if err != nil {
+			return "", err
+		}
+		buckets, err := a.Histogram()
+		if err != nil {
+			return "", err
+		}
+		parts := []string{fmt.Sprintf("count=%d", count), "sum=" + sum.Emit(kind)}
+		var cum uint64
+		for i, bound := range buckets.Boundaries {
+			cum += buckets.Counts[i]
+			parts = append(parts, fmt.Sprintf("le%s=%d", strconv.FormatFloat(bound, 'f', -1, 64), cum))
+			if cum == count {
+				break
+			}
+		}
+		return strings.Join(parts, " "), nil
+	case aggregation.MinMaxSumCount:
+		count, err := a.Count()
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "count=0", nil
+		}
+		min, err := a.Min()
+		if err != nil {
+			return "", err
+		}
+		max, err := a.Max()
+		if err != nil {
+			return "", err
+		}
+		sum, err := a.Sum()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("count=%d min=%s max=%s sum=%s", count, min.Emit(kind), max.Emit(kind), sum.Emit(kind)), nil
+	case aggregation.LastValue:
+		v, _, err := a.LastValue()
+		if err != nil {
+			return "", err
+		}
+		return v.Emit(kind), nil
+	case aggregation.Sum:
+		v, err := a.Sum()
+		if err != nil {
+			return "", err
+		}
+		return v.Emit(kind), nil
+	}
+	return "", fmt.Errorf("unsupported aggregation %s", agg.Kind())
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+type fakeClient struct{ err error }
+
+func (c fakeClient) Start(context.Context) error { return nil }
+func (c fakeClient) Stop(context.Context) error  { return nil }
+func (c fakeClient) UploadMetrics(context.Context, []*metricpb.ResourceMetrics) error {
+	return c.err
+}
+
+func TestFprint(t *testing.T) {
+	ctx := context.Background()
+	cont := controller.New(processor.New(Selector(), export.CumulativeExportKindSelector()))
+	m := New(cont.MeterProvider())
+	m.ObserveQueue(func() (int, int64) { return 2, 512 })
+	m.Retried(nil, 0)
+	m.Retried(nil, 0)
+	m.Rejected(3, "dropped")
+	m.Rejected(1, "resent")
+	m.QueueDropped()
+	rms := []*metricpb.ResourceMetrics{{InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{{
+		Metrics: []*metricpb.Metric{{Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{
+			DataPoints: []*metricpb.NumberDataPoint{{}, {}},
+		}}}},
+	}}}}
+	if err := m.Delivery(fakeClient{}).UploadMetrics(ctx, rms); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delivery(fakeClient{err: errors.New("failed")}).UploadMetrics(ctx, rms); err == nil {
+		t.Fatal("got nil error")
+	}
+	// The transport's latency depends on the machine, so the histogram is
+	// fed directly.
+	latency := metric.Must(cont.MeterProvider().Meter("test")).NewFloat64ValueRecorder(UploadLatency)
+	latency.Record(ctx, 3)
+	latency.Record(ctx, 7.5)
+	if err := cont.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := Fprint(&b, cont); err != nil {
+		t.Fatal(err)
+	}
+	want := `exporter.points.delivered 2
+exporter.points.failed 2
+exporter.points.rejected{action=dropped} 3
+exporter.points.rejected{action=resent} 1
+exporter.queue.batches 2
+exporter.queue.bytes 512
+exporter.queue.dropped 1
+exporter.retries 2
+exporter.upload.latency count=2 sum=10.500000 le1=0 le2=0 le5=1 le10=2
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
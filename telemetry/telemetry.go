@@ -0,0 +1,251 @@
+// Package telemetry records metrics about the harness's own export path:
+// the uploads its client makes, their outcome, size and latency, retries,
+// rejected points and the depth of the persistent queue. The instruments
+// belong to a MeterProvider of their own, so they never mix with the
+// metrics under test.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlpclient"
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlphttp"
+	"github.com/tyrone-anz/export-otlp-googlecloud/rules"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// InstrumentationName names the meter the instruments are created with.
+const InstrumentationName = "github.com/tyrone-anz/export-otlp-googlecloud/telemetry"
+
+// Instrument names.
+const (
+	UploadsAttempted = "exporter.uploads.attempted"
+	UploadsSucceeded = "exporter.uploads.succeeded"
+	UploadsFailed    = "exporter.uploads.failed"
+	UploadPoints     = "exporter.upload.points"
+	UploadBytes      = "exporter.upload.bytes"
+	UploadLatency    = "exporter.upload.latency"
+	Retries          = "exporter.retries"
+	PointsDelivered  = "exporter.points.delivered"
+	PointsFailed     = "exporter.points.failed"
+	PointsRejected   = "exporter.points.rejected"
+	QueueBatches     = "exporter.queue.batches"
+	QueueBytes       = "exporter.queue.bytes"
+	QueueDropped     = "exporter.queue.dropped"
+)
+
+// LatencyBoundaries are the histogram boundaries of UploadLatency, in
+// milliseconds.
+var LatencyBoundaries = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var (
+	codeKey   = attribute.Key("code")
+	actionKey = attribute.Key("action")
+)
+
+// Selector returns the aggregators the instruments are meant for: a
+// histogram with LatencyBoundaries for UploadLatency, the last value for
+// the queue gauges, and the inexpensive distribution otherwise.
+func Selector() export.AggregatorSelector {
+	s, err := rules.NewAggregatorSelector([]rules.AggregatorRule{
+		{Match: rules.Match{Name: UploadLatency}, Aggregator: "histogram", Boundaries: LatencyBoundaries},
+		{Match: rules.Match{Name: "exporter.queue.*", InstrumentKinds: []string{"ValueObserver"}}, Aggregator: "lastvalue"},
+	}, selector.NewWithInexpensiveDistribution())
+	if err != nil {
+		// The rules above are fixed.
+		panic(err)
+	}
+	return s
+}
+
+// Metrics holds the instruments. A nil *Metrics records nothing, and its
+// wrappers return the client unchanged, so callers need not check whether
+// self-telemetry is enabled.
+type Metrics struct {
+	meter metric.MeterMust
+
+	attempted metric.Int64Counter
+	succeeded metric.Int64Counter
+	failed    metric.Int64Counter
+	points    metric.Int64ValueRecorder
+	bytes     metric.Int64ValueRecorder
+	latency   metric.Float64ValueRecorder
+	retries   metric.Int64Counter
+	delivered metric.Int64Counter
+	lost      metric.Int64Counter
+	rejected  metric.Int64Counter
+	dropped   metric.Int64Counter
+}
+
+// New creates the instruments on a meter of provider.
+func New(provider metric.MeterProvider) *Metrics {
+	meter := metric.Must(provider.Meter(InstrumentationName))
+	counter := func(name, desc string) metric.Int64Counter {
+		return meter.NewInt64Counter(name, metric.WithDescription(desc), metric.WithUnit(unit.Dimensionless))
+	}
+	return &Metrics{
+		meter:     meter,
+		attempted: counter(UploadsAttempted, "Uploads handed to the transport"),
+		succeeded: counter(UploadsSucceeded, "Uploads the transport completed"),
+		failed:    counter(UploadsFailed, "Uploads the transport failed, by gRPC code or HTTP status"),
+		points: meter.NewInt64ValueRecorder(UploadPoints,
+			metric.WithDescription("Points per upload"), metric.WithUnit(unit.Dimensionless)),
+		bytes: meter.NewInt64ValueRecorder(UploadBytes,
+			metric.WithDescription("Encoded size of each upload"), metric.WithUnit(unit.Bytes)),
+		latency: meter.NewFloat64ValueRecorder(UploadLatency,
+			metric.WithDescription("Time the transport took for each upload"), metric.WithUnit(unit.Milliseconds)),
+		retries:   counter(Retries, "Requests sent again by the retrying client, one per split of resent points"),
+		delivered: counter(PointsDelivered, "Points of uploads that succeeded after any retries"),
+		lost:      counter(PointsFailed, "Points of uploads that failed after any retries"),
+		rejected:  counter(PointsRejected, "Points a partially failed request rejected, by action taken"),
+		dropped:   counter(QueueDropped, "Batches discarded by the persistent queue"),
+	}
+}
+
+// ObserveQueue reports the depth fn returns, such as the Pending method of
+// an otlpclient.QueuedClient, at every collection.
+func (m *Metrics) ObserveQueue(fn func() (batches int, bytes int64)) {
+	if m == nil {
+		return
+	}
+	m.meter.NewInt64ValueObserver(QueueBatches, func(_ context.Context, r metric.Int64ObserverResult) {
+		n, _ := fn()
+		r.Observe(int64(n))
+	}, metric.WithDescription("Batches waiting in the persistent queue"))
+	m.meter.NewInt64ValueObserver(QueueBytes, func(_ context.Context, r metric.Int64ObserverResult) {
+		_, size := fn()
+		r.Observe(size)
+	}, metric.WithDescription("Size of the persistent queue on disk"), metric.WithUnit(unit.Bytes))
+}
+
+// Retried counts one retry. Its signature suits otlpclient.WithRetryHandler.
+func (m *Metrics) Retried(error, time.Duration) {
+	if m == nil {
+		return
+	}
+	m.retries.Add(context.Background(), 1)
+}
+
+// Rejected counts points a partially failed request rejected, labelled
+// with what was done with them.
+func (m *Metrics) Rejected(points int, action string) {
+	if m == nil {
+		return
+	}
+	m.rejected.Add(context.Background(), int64(points), actionKey.String(action))
+}
+
+// QueueDropped counts one batch discarded by the persistent queue.
+func (m *Metrics) QueueDropped() {
+	if m == nil {
+		return
+	}
+	m.dropped.Add(context.Background(), 1)
+}
+
+// Transport wraps the client that sends uploads on the wire, so that each
+// attempt is counted, sized and timed.
+func (m *Metrics) Transport(client otlpmetric.Client) otlpmetric.Client {
+	if m == nil {
+		return client
+	}
+	return &transportClient{client: client, m: m}
+}
+
+// Delivery wraps a client whose uploads have been through any retries,
+// so that their points are counted as delivered or failed.
+func (m *Metrics) Delivery(client otlpmetric.Client) otlpmetric.Client {
+	if m == nil {
+		return client
+	}
+	return &deliveryClient{client: client, m: m}
+}
+
+type transportClient struct {
+	client otlpmetric.Client
+	m      *Metrics
+}
+
+// Start starts the wrapped client.
+func (c *transportClient) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *transportClient) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics records the attempt and its outcome.
+func (c *transportClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	// Recordings use their own context; ctx may already be done by the
+	// time the outcome is known.
+	rctx := context.Background()
+	c.m.attempted.Add(rctx, 1)
+	c.m.points.Record(rctx, int64(otlpclient.PointCount(protoMetrics)))
+	size := proto.Size(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: protoMetrics})
+	c.m.bytes.Record(rctx, int64(size))
+
+	start := time.Now()
+	err := c.client.UploadMetrics(ctx, protoMetrics)
+	c.m.latency.Record(rctx, float64(time.Since(start))/float64(time.Millisecond))
+	if err != nil {
+		c.m.failed.Add(rctx, 1, codeKey.String(Code(err)))
+	} else {
+		c.m.succeeded.Add(rctx, 1)
+	}
+	return err
+}
+
+type deliveryClient struct {
+	client otlpmetric.Client
+	m      *Metrics
+}
+
+// Start starts the wrapped client.
+func (c *deliveryClient) Start(ctx context.Context) error {
+	return c.client.Start(ctx)
+}
+
+// Stop stops the wrapped client.
+func (c *deliveryClient) Stop(ctx context.Context) error {
+	return c.client.Stop(ctx)
+}
+
+// UploadMetrics counts the points of protoMetrics by outcome.
+func (c *deliveryClient) UploadMetrics(ctx context.Context, protoMetrics []*metricpb.ResourceMetrics) error {
+	err := c.client.UploadMetrics(ctx, protoMetrics)
+	n := int64(otlpclient.PointCount(protoMetrics))
+	if err != nil {
+		c.m.lost.Add(context.Background(), n)
+	} else {
+		c.m.delivered.Add(context.Background(), n)
+	}
+	return err
+}
+
+// Code names the failure of an upload: the gRPC code of a status error,
+// even a wrapped one, "HTTP n" for an otlphttp.StatusError, or Unknown.
+func Code(err error) string {
+	var se *otlphttp.StatusError
+	if errors.As(err, &se) {
+		return "HTTP " + strconv.Itoa(se.StatusCode)
+	}
+	var ge interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &ge) {
+		return ge.GRPCStatus().Code().String()
+	}
+	return "Unknown"
+}
@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tyrone-anz/export-otlp-googlecloud/otlphttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "status", err: status.Error(codes.InvalidArgument, "bad"), want: "InvalidArgument"},
+		{
+			name: "wrapped status",
+			err:  fmt.Errorf("metrics exporter is disconnected from the server x: %w", status.Error(codes.Unavailable, "down")),
+			want: "Unavailable",
+		},
+		{name: "HTTP", err: &otlphttp.StatusError{StatusCode: 503}, want: "HTTP 503"},
+		{name: "wrapped HTTP", err: fmt.Errorf("upload: %w", &otlphttp.StatusError{StatusCode: 400}), want: "HTTP 400"},
+		{name: "other", err: errors.New("boom"), want: "Unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Code(tc.err); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}